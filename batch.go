@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The outcome of converting one file in a batch.
+type batchResult struct {
+	inPath string
+	outPath string
+	warnings []string
+	err error
+}
+
+// Reports whether the file at path starts with an NCCH, NCSD or CIA header.
+func recognised(path string) bool {
+	file, err := os.Open(path)
+	if (err != nil) {
+		return false
+	}
+	defer file.Close()
+	return isContainer(file)
+}
+
+// Converts every recognised file under inDir, writing each output to the same
+// relative path under outDir with the extension replaced. Paths that cannot be
+// read are reported as failures and the rest are still converted.
+func batch(args []string) {
+	flags := newFlagSet("batch")
+	options := addInputFlags(flags, true)
+	outputFlags := addOutputFlags(flags)
+	jobs := flags.Int("j", runtime.NumCPU(), "Number of files converted at once")
+	flags.Parse(args)
+
+	if (flags.NArg() != 2) {
+		usageError(flags, "Expected an input and an output directory.")
+	}
+	if (*jobs < 1) {
+		usageError(flags, "-j must be at least 1.")
+	}
+	output := outputFlags.options(flags)
+	read := options.readOptions(flags)
+	inDir, outDir := flags.Arg(0), flags.Arg(1)
+
+	var paths []string
+	var unreadable []batchResult // Files and directories the walk could not read
+	err := filepath.Walk(inDir, func(path string, info os.FileInfo, err error) error {
+		if (err != nil && path == inDir) {
+			return err
+		}
+		if (err != nil) {
+			unreadable = append(unreadable, batchResult{inPath: path, err: err})
+			return nil
+		}
+		if (info.Mode().IsRegular() && recognised(path)) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	check(err)
+
+	// Outputs replace the input's extension, unless two inputs would then share an output.
+	results := make([]batchResult, len(paths))
+	uses := map[string]int{}
+	for i := 0; i < len(paths); i++ {
+		rel, err := filepath.Rel(inDir, paths[i])
+		check(err)
+		results[i].inPath = paths[i]
+		results[i].outPath = filepath.Join(outDir, strings.TrimSuffix(rel, filepath.Ext(rel)) + "." + output.format)
+		uses[results[i].outPath]++
+	}
+	for i := 0; i < len(paths); i++ {
+		if (uses[results[i].outPath] > 1) {
+			rel, _ := filepath.Rel(inDir, paths[i])
+			results[i].outPath = filepath.Join(outDir, rel + "." + output.format)
+		}
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < *jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				result := &results[j]
+				result.err = os.MkdirAll(filepath.Dir(result.outPath), 0755)
+				if (result.err == nil) {
+					result.warnings, result.err = convertFile(result.inPath, result.outPath, options, read, output)
+				}
+			}
+		}()
+	}
+	for i := 0; i < len(paths); i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	results = append(results, unreadable...)
+	sort.Slice(results, func(i, j int) bool { return results[i].inPath < results[j].inPath })
+	failed := 0
+	for i := 0; i < len(results); i++ {
+		result := &results[i]
+		if (result.err != nil) {
+			failed++
+			fmt.Printf("FAIL %s: %v\n", result.inPath, result.err)
+			continue
+		}
+		fmt.Printf("OK   %s -> %s\n", result.inPath, result.outPath)
+		for j := 0; j < len(result.warnings); j++ {
+			fmt.Printf("     Warning: %s\n", result.warnings[j])
+		}
+	}
+	fmt.Printf("%d converted, %d failed.\n", len(results) - failed, failed)
+	if (failed > 0) {
+		os.Exit(exitFindings)
+	}
+}
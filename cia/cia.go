@@ -0,0 +1,186 @@
+package cia
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"cxi2rsf/errs"
+	"cxi2rsf/rsf"
+)
+
+const headerSize = 0x2020
+
+type Content struct {
+	Id uint32
+	Index uint16
+	Type uint16
+	Size uint64
+	Hash [0x20]byte
+	Offset int64 // Absolute offset of the content within the CIA
+}
+
+type File struct {
+	CertChainSize uint32
+	TicketSize uint32
+	TmdSize uint32
+	MetaSize uint32
+	ContentSize uint64
+
+	TitleId uint64
+	TitleVersion uint16
+	Contents []Content
+}
+
+// Signature sizes including padding, keyed by signature type.
+var signatureSizes = map[uint32]int64 {
+	0x010000: 0x200 + 0x3C, // RSA_4096 SHA1
+	0x010001: 0x100 + 0x3C, // RSA_2048 SHA1
+	0x010002: 0x3C + 0x40,  // ECDSA SHA1
+	0x010003: 0x200 + 0x3C, // RSA_4096 SHA256
+	0x010004: 0x100 + 0x3C, // RSA_2048 SHA256
+	0x010005: 0x3C + 0x40,  // ECDSA SHA256
+}
+
+// Every section of a CIA starts on a 64-byte boundary.
+func align64(offset int64) int64 {
+	return (offset + 63) &^ 63
+}
+
+// Match reports whether header is the start of a CIA.
+func Match(header []byte) bool {
+	return len(header) >= 0x20 && binary.LittleEndian.Uint32(header[0:]) == headerSize && binary.LittleEndian.Uint16(header[4:]) == 0
+}
+
+// Parse reads the CIA header and TMD, and locates the contents present in the CIA.
+func Parse(in io.ReaderAt) (*File, error) {
+	header := make([]byte, headerSize)
+	if n, _ := in.ReadAt(header, 0); n != len(header) {
+		return nil, &errs.TruncatedError{What: "CIA header", Size: headerSize, Read: int64(n)}
+	}
+
+	cia := &File{}
+	cia.CertChainSize = binary.LittleEndian.Uint32(header[0x8:])
+	cia.TicketSize = binary.LittleEndian.Uint32(header[0xC:])
+	cia.TmdSize = binary.LittleEndian.Uint32(header[0x10:])
+	cia.MetaSize = binary.LittleEndian.Uint32(header[0x14:])
+	cia.ContentSize = binary.LittleEndian.Uint64(header[0x18:])
+	contentIndex := header[0x20:0x2020]
+
+	tmdOffset := align64(headerSize)
+	tmdOffset = align64(tmdOffset + int64(cia.CertChainSize))
+	tmdOffset = align64(tmdOffset + int64(cia.TicketSize))
+	contentOffset := align64(tmdOffset + int64(cia.TmdSize))
+
+	if err := errs.CheckSize(in, "TMD", tmdOffset, int64(cia.TmdSize)); err != nil {
+		return nil, err
+	}
+	tmd := make([]byte, cia.TmdSize)
+	if n, _ := in.ReadAt(tmd, tmdOffset); n != len(tmd) || n < 4 {
+		return nil, &errs.TruncatedError{What: "TMD", Offset: tmdOffset, Size: int64(len(tmd)), Read: int64(n)}
+	}
+
+	signatureSize, ok := signatureSizes[binary.BigEndian.Uint32(tmd[0:])]
+	if (!ok) {
+		return nil, fmt.Errorf("Unknown TMD signature type 0x%x at 0x%x.", binary.BigEndian.Uint32(tmd[0:]), tmdOffset)
+	}
+	tmdHeaderOffset := tmdOffset + 4 + signatureSize
+	if (int64(len(tmd)) < 4 + signatureSize + 0xC4 + 0x900) {
+		return nil, &errs.TruncatedError{What: "TMD header", Offset: tmdHeaderOffset, Size: 0xC4 + 0x900, Read: int64(len(tmd)) - 4 - signatureSize}
+	}
+	tmdHeader := tmd[4 + signatureSize:]
+
+	// The header hashes the content info records, which each hash a run of content chunks.
+	infoRecords := tmdHeader[0xC4:0xC4 + 0x900]
+	if err := checkHash("TMD content info records", tmdHeaderOffset + 0xC4, infoRecords, tmdHeader[0xA4:0xC4]); err != nil {
+		return nil, err
+	}
+
+	cia.TitleId = binary.BigEndian.Uint64(tmdHeader[0x4C:])
+	cia.TitleVersion = binary.BigEndian.Uint16(tmdHeader[0x9C:])
+	contentCount := int(binary.BigEndian.Uint16(tmdHeader[0x9E:]))
+
+	chunks := tmdHeader[0xC4 + 0x900:]
+	chunksOffset := tmdHeaderOffset + 0xC4 + 0x900
+	if (len(chunks) < contentCount * 0x30) {
+		return nil, &errs.TruncatedError{What: "TMD content chunks", Offset: chunksOffset, Size: int64(contentCount) * 0x30, Read: int64(len(chunks))}
+	}
+	for i := 0; i < 64; i++ {
+		record := infoRecords[i * 0x24:]
+		index := int(binary.BigEndian.Uint16(record[0:]))
+		count := int(binary.BigEndian.Uint16(record[2:]))
+		if (count == 0) {
+			continue
+		}
+		if (index + count > contentCount) {
+			return nil, &errs.TruncatedError{What: "TMD content chunks", Offset: chunksOffset, Size: int64(index + count) * 0x30, Read: int64(contentCount) * 0x30}
+		}
+		if err := checkHash("TMD content chunks", chunksOffset + int64(index) * 0x30, chunks[index * 0x30:(index + count) * 0x30], record[4:0x24]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only contents flagged in the content index are present in the CIA, in TMD order.
+	for i := 0; i < contentCount; i++ {
+		chunk := chunks[i * 0x30:]
+		content := Content{}
+		content.Id = binary.BigEndian.Uint32(chunk[0:])
+		content.Index = binary.BigEndian.Uint16(chunk[4:])
+		content.Type = binary.BigEndian.Uint16(chunk[6:])
+		content.Size = binary.BigEndian.Uint64(chunk[8:])
+		copy(content.Hash[:], chunk[0x10:0x30])
+		if ((contentIndex[content.Index >> 3] & (0x80 >> (content.Index & 7))) == 0) {
+			continue
+		}
+		content.Offset = contentOffset
+		contentOffset += int64(content.Size)
+		cia.Contents = append(cia.Contents, content)
+	}
+
+	return cia, nil
+}
+
+func checkHash(what string, offset int64, data []byte, expected []byte) error {
+	actual := sha256.Sum256(data)
+	if (!bytes.Equal(actual[:], expected)) {
+		return &errs.HashMismatchError{What: what, Offset: offset, Expected: expected, Actual: actual[:]}
+	}
+	return nil
+}
+
+// Content returns the content with the given index, if it is present and not encrypted.
+func (cia *File) Content(index uint16) (*Content, error) {
+	for i := 0; i < len(cia.Contents); i++ {
+		content := &cia.Contents[i]
+		if (content.Index != index) {
+			continue
+		}
+		if ((content.Type & 1) != 0) {
+			return nil, fmt.Errorf("Content %d is encrypted with the title key.", index)
+		}
+		return content, nil
+	}
+	return nil, fmt.Errorf("Content %d is not present.", index)
+}
+
+// CrossCheck returns warnings for TMD values that disagree with the RSF built
+// from content 0. makerom derives the TMD title version's major number from
+// RemasterVersion, and the TMD title ID, including its low byte
+// TitleInfo.Version, from the program ID.
+func (cia *File) CrossCheck(r *rsf.Rsf, programId uint64) (warnings []string) {
+	major := cia.TitleVersion >> 10
+	minor := (cia.TitleVersion >> 4) & 0b111111
+	micro := cia.TitleVersion & 0b1111
+	if (major != r.SystemControlInfo.RemasterVersion) {
+		warnings = append(warnings, fmt.Sprintf("TMD title version v%d (%d.%d.%d) does not match RemasterVersion %d.", cia.TitleVersion, major, minor, micro, r.SystemControlInfo.RemasterVersion))
+	}
+	if (uint8(cia.TitleId) != r.TitleInfo.Version) {
+		warnings = append(warnings, fmt.Sprintf("TMD title ID %016x has version %d in its low byte, which does not match TitleInfo.Version %d.", cia.TitleId, uint8(cia.TitleId), r.TitleInfo.Version))
+	}
+	if (cia.TitleId != programId) {
+		warnings = append(warnings, fmt.Sprintf("TMD title ID %016x does not match program ID %016x.", cia.TitleId, programId))
+	}
+	return
+}
@@ -0,0 +1,109 @@
+// Package errs holds the errors returned for malformed input. Each carries the
+// file offset of the structure involved, so problems in a dump can be located.
+package errs
+
+import (
+	"fmt"
+	"io"
+)
+
+// TruncatedError is returned when the input ends inside a structure.
+type TruncatedError struct {
+	What string
+	Offset int64
+	Size int64 // Bytes needed
+	Read int64 // Bytes available
+}
+
+func (err *TruncatedError) Error() string {
+	return fmt.Sprintf("Truncated %s at 0x%x: expected 0x%x bytes, found 0x%x.", err.What, err.Offset, err.Size, err.Read)
+}
+
+// BadMagicError is returned when a structure does not start with its magic.
+type BadMagicError struct {
+	What string
+	Offset int64 // Of the magic
+	Expected string
+	Found []byte
+}
+
+func (err *BadMagicError) Error() string {
+	return fmt.Sprintf("Not a valid %s: expected %q at 0x%x, found %q.", err.What, err.Expected, err.Offset, err.Found)
+}
+
+// HashMismatchError is returned when data does not match its SHA-256.
+type HashMismatchError struct {
+	What string
+	Offset int64 // Of the hashed data
+	Expected []byte
+	Actual []byte
+}
+
+func (err *HashMismatchError) Error() string {
+	return fmt.Sprintf("Hash mismatch in %s at 0x%x: expected %x, found %x.", err.What, err.Offset, err.Expected, err.Actual)
+}
+
+// UnknownCategoryError is returned for a program ID whose category has no RSF
+// name.
+type UnknownCategoryError struct {
+	Offset int64 // Of the program ID
+	Category uint16
+}
+
+func (err *UnknownCategoryError) Error() string {
+	return fmt.Sprintf("Unknown title category 0x%04x in the program ID at 0x%x.", err.Category, err.Offset)
+}
+
+// InvalidDescriptorError is returned for an ARM11 kernel capability descriptor
+// that cannot be decoded.
+type InvalidDescriptorError struct {
+	Offset int64 // Of the descriptor
+	Descriptor uint32
+	Reason string
+}
+
+func (err *InvalidDescriptorError) Error() string {
+	return fmt.Sprintf("Invalid kernel capability descriptor 0x%08x at 0x%x: %s.", err.Descriptor, err.Offset, err.Reason)
+}
+
+// Shift adds base to the offset carried by err, for errors found in a
+// structure read from base. Other errors are returned unchanged.
+func Shift(err error, base int64) error {
+	switch e := err.(type) {
+		case *TruncatedError:
+			e.Offset += base
+		case *BadMagicError:
+			e.Offset += base
+		case *HashMismatchError:
+			e.Offset += base
+		case *UnknownCategoryError:
+			e.Offset += base
+		case *InvalidDescriptorError:
+			e.Offset += base
+	}
+	return err
+}
+
+// CheckSize returns a TruncatedError if in holds fewer than size bytes at
+// offset. Sizes read from the input are checked with it before a buffer is
+// allocated for them, so a corrupted size cannot exhaust memory.
+func CheckSize(in io.ReaderAt, what string, offset int64, size int64) error {
+	readable := func(n int64) bool { // Whether the first n bytes can be read
+		b := make([]byte, 1)
+		read, _ := in.ReadAt(b, offset + n - 1)
+		return n == 0 || read == 1
+	}
+	if (readable(size)) {
+		return nil
+	}
+	available, missing := int64(0), size // Bytes known to be readable and not
+	for (missing - available > 1) {
+		middle := available + (missing - available) / 2
+		if (readable(middle)) {
+			available = middle
+		} else {
+			missing = middle
+		}
+	}
+	return &TruncatedError{What: what, Offset: offset, Size: size, Read: available}
+}
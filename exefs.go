@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cxi2rsf/ncch"
+)
+
+// Where an ExeFS file is written: beside the output, e.g. out.rsf and icon ->
+// out.icon.bin. The decompressed .code is written as code.bin.
+func exefsOutPath(outPath string, name string) string {
+	if (name == ".code") {
+		return filepath.Join(filepath.Dir(outPath), "code.bin")
+	}
+	return strings.TrimSuffix(outPath, filepath.Ext(outPath)) + "." + strings.TrimPrefix(name, ".") + ".bin"
+}
+
+// Returns .code decompressed if it is compressed, warning when that disagrees
+// with EnableCompress. Code with a compression footer that does not decode is
+// an error.
+func decompressCode(t *title, data []byte) ([]byte, error) {
+	code, err := ncch.DecompressCode(data)
+	var notCompressed *ncch.NotCompressedError
+	if (err != nil && !errors.As(err, &notCompressed)) {
+		return nil, fmt.Errorf("Cannot decompress .code: %v", err)
+	}
+	compressed := (err == nil)
+	if (t.rsf.Option.EnableCompress && !compressed) {
+		t.warnings = append(t.warnings, "EnableCompress is set, but .code is not compressed: " + err.Error())
+	} else if (!t.rsf.Option.EnableCompress && compressed) {
+		t.warnings = append(t.warnings, "EnableCompress is not set, but .code is compressed.")
+	}
+	if (compressed) {
+		return code, nil
+	}
+	return data, nil
+}
+
+// Converts the input as convert does, and writes every ExeFS file beside the
+// output, listing each with its offset, size and whether it matches its hash.
+// .code is written decompressed, as code.bin.
+func extractExefs(args []string) {
+	flags := newFlagSet("extract-exefs")
+	options := addInputFlags(flags, false)
+	outputFlags := addOutputFlags(flags)
+	outPath := flags.String("o", "", "Output file, the ExeFS files are written beside it as <output>.<name>.bin, and .code as code.bin (default: the input with its extension replaced)")
+	flags.Parse(args)
+
+	if (flags.NArg() == 2 && *outPath == "") {
+		*outPath = flags.Arg(1)
+	} else if (flags.NArg() != 1) {
+		usageError(flags, "Expected one input.")
+	}
+	output := outputFlags.options(flags)
+	read := options.readOptions(flags)
+	if (*outPath == "") {
+		*outPath = defaultOutPath(flags.Arg(0), output.format)
+	}
+	if (*outPath == "-") {
+		usageError(flags, "The ExeFS files are written beside the output, which cannot be standard output.")
+	}
+
+	in, err := openInput(flags.Arg(0))
+	check(err)
+	defer in.Close()
+
+	offset, _, err := options.locate(in)
+	check(err)
+	t, err := readTitle(in, offset, read)
+	check(err)
+	exefs, err := ncch.OpenExefs(in, offset, t.header, read.crypto)
+	check(err)
+	if (exefs == nil) {
+		printWarnings(t.warnings)
+		check(fmt.Errorf("The NCCH has no ExeFS."))
+	}
+	check(writeTitle(t, *outPath, output))
+
+	failed := 0
+	for i := 0; i < len(exefs.Files); i++ {
+		file := &exefs.Files[i]
+		data, err := exefs.Read(file)
+		if (err == nil && strings.ContainsAny(file.Name, "/\\")) {
+			err = fmt.Errorf("Invalid ExeFS file name %q.", file.Name)
+		}
+		if (err == nil && file.Name == ".code") {
+			data, err = decompressCode(t, data)
+		}
+		if (err == nil) {
+			err = os.WriteFile(exefsOutPath(*outPath, file.Name), data, 0644)
+		}
+		status := "OK"
+		if (err != nil) {
+			status = "FAILED"
+			t.warnings = append(t.warnings, err.Error())
+			failed++
+		}
+		fmt.Printf("%-8s 0x%08x 0x%08x %s\n", file.Name, exefs.Offset(file), file.Size, status)
+	}
+	printWarnings(t.warnings)
+	if (failed > 0) {
+		fmt.Fprintf(os.Stderr, "%d ExeFS files could not be extracted.\n", failed)
+		os.Exit(exitError)
+	}
+}
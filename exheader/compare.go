@@ -0,0 +1,120 @@
+package exheader
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Difference is a field whose value differs between two exheaders.
+type Difference struct {
+	Field string
+	Original string
+	Encoded string
+}
+
+// Fields makerom takes from the ELF or its own defaults rather than the RSF.
+var notInRsf = map[string]bool {
+	"SystemControlInfo.Reserved1": true,
+	"SystemControlInfo.Text": true,
+	"SystemControlInfo.ReadOnly": true,
+	"SystemControlInfo.Reserved2": true,
+	"SystemControlInfo.Data": true,
+	"SystemControlInfo.BssSize": true,
+	"SystemControlInfo.Reserved3": true,
+	"AccessControlInfo.Arm11LocalCaps.Reserved": true,
+	"AccessControlInfo.Arm11KernelCaps.Reserved": true,
+}
+
+// Compare reports every field of encoded that differs from original, other
+// than the ones an RSF cannot describe. Kernel capabilities are compared by
+// what they grant rather than by descriptor order.
+func Compare(original *Exheader, encoded *Exheader) []Difference {
+	differences := []Difference{}
+	compareValue(reflect.ValueOf(*original), reflect.ValueOf(*encoded), "", &differences)
+
+	originalCaps := DescribeKernelCaps(original.AccessControlInfo.Arm11KernelCaps.Descriptors[:])
+	encodedCaps := DescribeKernelCaps(encoded.AccessControlInfo.Arm11KernelCaps.Descriptors[:])
+	missing, added := subtract(originalCaps, encodedCaps), subtract(encodedCaps, originalCaps)
+	for i := 0; i < len(missing); i++ {
+		differences = append(differences, Difference{"AccessControlInfo.Arm11KernelCaps", missing[i], ""})
+	}
+	for i := 0; i < len(added); i++ {
+		differences = append(differences, Difference{"AccessControlInfo.Arm11KernelCaps", "", added[i]})
+	}
+	return differences
+}
+
+func compareValue(a reflect.Value, b reflect.Value, path string, differences *[]Difference) {
+	if (notInRsf[path] || path == "AccessControlInfo.Arm11KernelCaps.Descriptors") {
+		return
+	}
+	switch (a.Kind()) {
+		case reflect.Struct:
+			for i := 0; i < a.NumField(); i++ {
+				name := a.Type().Field(i).Name
+				if (path != "") {
+					name = path + "." + name
+				}
+				compareValue(a.Field(i), b.Field(i), name, differences)
+			}
+		case reflect.Array:
+			if (a.Type().Elem().Kind() == reflect.Uint8) { // Compare byte arrays as a whole
+				if (!reflect.DeepEqual(a.Interface(), b.Interface())) {
+					*differences = append(*differences, Difference{path, fmt.Sprintf("%x", a.Interface()), fmt.Sprintf("%x", b.Interface())})
+				}
+				return
+			}
+			for i := 0; i < a.Len(); i++ {
+				compareValue(a.Index(i), b.Index(i), fmt.Sprintf("%s[%d]", path, i), differences)
+			}
+		default:
+			if (a.Interface() != b.Interface()) {
+				*differences = append(*differences, Difference{path, fmt.Sprintf("0x%x", a.Interface()), fmt.Sprintf("0x%x", b.Interface())})
+			}
+	}
+}
+
+// Returns the items of a not in b, counting duplicates.
+func subtract(a []string, b []string) (out []string) {
+	count := map[string]int{}
+	for i := 0; i < len(b); i++ {
+		count[b[i]]++
+	}
+	for i := 0; i < len(a); i++ {
+		if (count[a[i]] > 0) {
+			count[a[i]]--
+		} else {
+			out = append(out, a[i])
+		}
+	}
+	return
+}
+
+// DescribeKernelCaps lists what the descriptors grant, one item per interrupt,
+// system call, mapping or setting, sorted so descriptor order does not matter.
+func DescribeKernelCaps(descriptors []uint32) []string {
+	caps := DecodeKernelCaps(descriptors)
+	items := []string{}
+	for i := 0; i < len(caps.Interrupts); i++ {
+		items = append(items, fmt.Sprintf("interrupt 0x%02x", caps.Interrupts[i]))
+	}
+	for i := 0; i < len(caps.SystemCalls); i++ {
+		items = append(items, fmt.Sprintf("svc 0x%02x", caps.SystemCalls[i]))
+	}
+	items = append(items, fmt.Sprintf("kernel version %d.%d", caps.KernelMajor, caps.KernelMinor))
+	items = append(items, fmt.Sprintf("handle table size 0x%x", caps.HandleTableSize))
+	items = append(items, fmt.Sprintf("kernel flags 0x%06x", caps.Flags))
+	for i := 0; i < len(caps.Mappings); i++ {
+		kind := "io mapping"
+		if (caps.Mappings[i].Static) {
+			kind = "memory mapping"
+		}
+		items = append(items, kind + " " + caps.Mappings[i].String())
+	}
+	for i := 0; i < len(caps.Other); i++ {
+		items = append(items, fmt.Sprintf("descriptor 0x%08x", caps.Other[i]))
+	}
+	sort.Strings(items)
+	return items
+}
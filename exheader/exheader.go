@@ -0,0 +1,124 @@
+package exheader
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"cxi2rsf/errs"
+)
+
+// Size of the SCI and ACI, the part of the extended header described by the RSF.
+const Size = 0x400
+
+type CodeSetInfo struct {
+	Address uint32
+	PhysicalRegionSize uint32 // In pages
+	Size uint32
+}
+
+type SystemControlInfo struct {
+	Title [8]byte
+	Reserved1 [5]byte
+	Flag byte
+	RemasterVersion uint16
+	Text CodeSetInfo
+	StackSize uint32
+	ReadOnly CodeSetInfo
+	Reserved2 [4]byte
+	Data CodeSetInfo
+	BssSize uint32
+	Dependencies [48]uint64
+	SaveDataSize uint64
+	JumpId uint64
+	Reserved3 [0x30]byte
+}
+
+// Bits of SystemControlInfo.Flag.
+const (
+	CompressExefsCode = 1 << 0
+	SdApplication = 1 << 1
+)
+
+type StorageInfo struct {
+	ExtSaveDataId uint64
+	SystemSaveDataIds [2]uint32
+	StorageAccessibleUniqueIds uint64
+	FileSystemAccessInfo [7]byte
+	OtherAttributes byte
+}
+
+// Bits of StorageInfo.OtherAttributes.
+const (
+	NotUseRomfs = 1 << 0
+	UseExtendedSaveDataAccess = 1 << 1
+)
+
+type Arm11LocalCaps struct {
+	ProgramId uint64
+	CoreVersion uint32
+	Flag1 byte
+	Flag2 byte
+	Flag0 byte
+	Priority byte
+	ResourceLimitDescriptors [16]uint16
+	StorageInfo StorageInfo
+	ServiceAccessControl [34][8]byte
+	Reserved [0xF]byte
+	ResourceLimitCategory byte
+}
+
+type Arm11KernelCaps struct {
+	Descriptors [28]uint32
+	Reserved [0x10]byte
+}
+
+type Arm9AccessControl struct {
+	Descriptors [15]byte
+	DescVersion byte
+}
+
+type AccessControlInfo struct {
+	Arm11LocalCaps Arm11LocalCaps
+	Arm11KernelCaps Arm11KernelCaps
+	Arm9AccessControl Arm9AccessControl
+}
+
+// Exheader is the SCI and ACI. The access descriptor that follows them in the
+// full 0x800-byte extended header is not included.
+type Exheader struct {
+	SystemControlInfo SystemControlInfo
+	AccessControlInfo AccessControlInfo
+}
+
+// Parse decodes the SCI and ACI at the start of data.
+func Parse(data []byte) (*Exheader, error) {
+	if (len(data) < Size) {
+		return nil, &errs.TruncatedError{What: "exheader", Size: Size, Read: int64(len(data))}
+	}
+
+	exheader := &Exheader{}
+	err := binary.Read(bytes.NewReader(data[0:Size]), binary.LittleEndian, exheader)
+	if (err != nil) {
+		return nil, err
+	}
+	return exheader, nil
+}
+
+// Bytes encodes the exheader back into its 0x400-byte form.
+func (exheader *Exheader) Bytes() []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, exheader)
+	return buf.Bytes()
+}
+
+// FileSystemAccess returns the 56-bit FS access info as an integer.
+func (storage *StorageInfo) FileSystemAccess() uint64 {
+	var info [8]byte
+	copy(info[:], storage.FileSystemAccessInfo[:])
+	return binary.LittleEndian.Uint64(info[:])
+}
+
+// DescriptorMask returns the first four descriptor bytes as an integer.
+func (arm9 *Arm9AccessControl) DescriptorMask() uint32 {
+	return binary.LittleEndian.Uint32(arm9.Descriptors[0:])
+}
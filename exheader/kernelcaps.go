@@ -0,0 +1,118 @@
+package exheader
+
+import (
+	"fmt"
+)
+
+// Offset of the kernel capability descriptors within the exheader.
+const KernelCapsOffset = 0x370
+
+const UnusedDescriptor = 0xFFFFFFFF
+
+// Bits of the kernel flags descriptor that have a meaning.
+const knownKernelFlags = 0x3FFF
+
+// Mapping is an address range granted by a pair of mapping descriptors, or a
+// single page granted by a page descriptor.
+type Mapping struct {
+	Start uint32
+	End uint32 // Last byte
+	ReadOnly bool
+	Static bool // Memory rather than IO registers
+	Page bool // Single page descriptor, always IO
+}
+
+// String formats the mapping as makerom reads it: start-end or, for a
+// single page, start, with :r when read-only.
+func (mapping *Mapping) String() string {
+	text := fmt.Sprintf("%x-%x", mapping.Start, mapping.End)
+	if (mapping.Page) {
+		text = fmt.Sprintf("%x", mapping.Start)
+	}
+	if (mapping.ReadOnly) {
+		text += ":r"
+	}
+	return text
+}
+
+// KernelCaps is the decoded form of the ARM11 kernel capability descriptors.
+type KernelCaps struct {
+	Interrupts []uint8
+	SystemCalls []uint32
+	KernelMajor uint8
+	KernelMinor uint8
+	HandleTableSize uint32
+	Flags uint32 // Kernel flags, without the type bits
+	Mappings []Mapping
+	Other []uint32 // Descriptors no RSF key can express, kept as is
+	Unpaired []int // Indices of mapping start descriptors without an end
+}
+
+// DescriptorType returns the type bits of a kernel capability descriptor: its
+// leading ones.
+func DescriptorType(descriptor uint32) (descriptorType uint32) {
+	for j := 31; j >= 0; j-- {
+		k := descriptor & (1 << j)
+		if (k == 0) {
+			break
+		}
+		descriptorType |= k
+	}
+	return
+}
+
+// DecodeKernelCaps decodes every descriptor. Descriptors of no known class,
+// and kernel flags with unknown bits set, are kept in Other.
+func DecodeKernelCaps(descriptors []uint32) *KernelCaps {
+	caps := &KernelCaps{}
+	for i := 0; i < len(descriptors); i++ {
+		descriptor := descriptors[i]
+		switch (DescriptorType(descriptor)) {
+			case 0xE0000000: // Interrupts, up to four packed from the top
+				for j := 3; j >= 0; j-- {
+					interrupt := (descriptor >> (j * 7)) & 0b1111111
+					if (interrupt != 0) {
+						caps.Interrupts = append(caps.Interrupts, uint8(interrupt))
+					}
+				}
+			case 0xF0000000: // System call mask for 24 IDs
+				index := (descriptor >> 24) & 0b111
+				for j := 0; j < 24; j++ {
+					if ((descriptor >> j) & 1 != 0) {
+						caps.SystemCalls = append(caps.SystemCalls, uint32(j) + 24 * index)
+					}
+				}
+			case 0xFC000000: // Kernel version
+				caps.KernelMajor = uint8((descriptor >> 8) & 0xFF)
+				caps.KernelMinor = uint8(descriptor & 0xFF)
+			case 0xFE000000: // Handle table size
+				caps.HandleTableSize = descriptor & 0x7FFFF
+			case 0xFF000000: // Kernel flags
+				caps.Flags = descriptor & 0x7FFFFF
+				if ((caps.Flags &^ knownKernelFlags) != 0) {
+					caps.Other = append(caps.Other, descriptor)
+				}
+			case 0xFF800000: // Address range, start then end
+				if (i + 1 == len(descriptors) || DescriptorType(descriptors[i + 1]) != 0xFF800000) {
+					caps.Unpaired = append(caps.Unpaired, i)
+					caps.Other = append(caps.Other, descriptor)
+					break
+				}
+				i += 1
+				end := descriptors[i]
+				caps.Mappings = append(caps.Mappings, Mapping{
+					Start: (descriptor & 0xFFFFF) << 12,
+					End: ((end & 0xFFFFF) << 12) - 1,
+					ReadOnly: (descriptor & (1 << 20)) != 0,
+					Static: (end & (1 << 20)) != 0,
+				})
+			case 0xFFE00000: // Single IO page
+				start := (descriptor & 0xFFFFF) << 12
+				caps.Mappings = append(caps.Mappings, Mapping{Start: start, End: start + 0xFFF, Page: true})
+			case UnusedDescriptor:
+			default:
+				caps.Other = append(caps.Other, descriptor)
+		}
+	}
+	return caps
+}
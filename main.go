@@ -1,942 +1,812 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	hexenc "encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"bytes"
-	"encoding/binary"
-	"unicode"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"cxi2rsf/cia"
+	"cxi2rsf/errs"
+	"cxi2rsf/exheader"
+	"cxi2rsf/ncch"
+	"cxi2rsf/ncsd"
+	"cxi2rsf/rsf"
 )
 
-type Rsf struct {
-	BasicInfo struct { 
-		Title string
-		CompanyCode string
-		ProductCode string
-		ContentType string
-		Logo string
-	}
-	RomFs struct { 
-		RootPath string
-	//	Reject string
-	//	Include string
-	//	File string
-	}
-	TitleInfo struct {
-		Platform string
-		Category string
-		UniqueId uint32
-		Version uint8
-		ContentsIndex uint8
-		Variation uint8
-		ChildIndex uint8
-		DemoIndex uint8
-	//	TargetCategory string
-	//	CategoryFlags string
-	}
-	Option struct {
-	//	AllowUnalignedSection bool
-	//	MediaFootPadding bool
-		EnableCrypt bool
-		EnableCompress bool
-		FreeProductCode bool
-		UseOnSD bool
-	}
-	AccessControlInfo struct {
-		DisableDebug bool
-		EnableForceDebug bool
-		CanWriteSharedPage bool
-		CanUsePrivilegedPriority bool
-		CanUseNonAlphabetAndNumber bool
-		PermitMainFunctionArgument bool
-		CanShareDeviceMemory bool
-		UseOtherVariationSaveData bool
-		RunnableOnSleep bool
-		SpecialMemoryArrange bool
-		CanAccessCore2 bool
-		UseExtSaveData bool
-		EnableL2Cache bool
-
-		IdealProcessor byte
-		Priority byte
-		MemoryType string
-		SystemMode string
-		SystemModeExt string
-		CpuSpeed string
-		CoreVersion uint16
-		HandleTableSize  uint32
-		SystemSaveDataId1 uint32
-		SystemSaveDataId2 uint32
-		OtherUserSaveDataId1 uint32
-		OtherUserSaveDataId2 uint32
-		OtherUserSaveDataId3 uint32
-		ExtSaveDataId uint32
-		AffinityMask byte
-		DescVersion uint8
-		ResourceLimitCategory string
-		ReleaseKernelMajor uint8
-		ReleaseKernelMinor uint8
-		MaxCpu uint8
-
-		MemoryMapping []string
-		IORegisterMapping []string
-		FileSystemAccess uint32 // Bitmask handled by output
-		IoAccessControl []string
-		InterruptNumbers []uint8
-		SystemCallAccess []uint32
-		ServiceAccessControl []string
-		AccessibleSaveDataIds []uint32
-	}
-	SystemControlInfo struct {
-		AppType string
-		StackSize uint32
-		RemasterVersion uint16
-		JumpId uint64
-		SaveDataSize uint64
-		Dependency []uint64
-	}
-}
-
-var category = map[uint16]string {
-	0x0000: "Application",
-	0x0010: "SystemApplication",
-	0x0030: "Applet",
-	0x0138: "Firmware",
-	0x0130: "Base",
-	0x0001: "DlpChild",
-	0x0002: "Demo",
-	0x0003: "Contents",
-	0x001B: "SystemContents",
-	0x009B: "SharedContents",
-	0x008C: "AddOnContents",
-	0x000E: "Patch",
-	0x00DB: "AutoUpdateContents",
-}
-
-var new3dsSystemMode = map[byte]string {
-	0: "Legacy",
-	1: "124MB",
-	2: "178MB",
-	3: "124MB",
-}
-
-var old3dsSystemMode = map[byte]string {
-	0: "64MB",
-	2: "96MB",
-	3: "80MB",
-	4: "72MB",
-	5: "32MB",
-}
-
-var filesystemAccessInfo = map[byte]string {
-	0: "CategorySystemApplication",
-	1: "CategoryHardwareCheck",
-	2: "CategoryFileSystemTool",
-	3: "Debug",
-	4: "TwlCardBackup",
-	5: "TwlNandData",
-	6: "Boss",
-	7: "DirectSdmc",
-	8: "Core",
-	9: "CtrNandRo",
-	10: "CtrNandRw",
-	11: "CtrNandRoWrite",
-	12: "CategorySystemSettings",
-	13: "CardBoard",
-	14: "ExportImportIvs",
-	15: "DirectSdmcWrite",
-	16: "SwitchCleanup",
-	17: "SaveDataMove",
-	18: "Shop",
-	19: "Shell",
-	20: "CategoryHomeMenu",
-	21: "SeedDB",
-}
-
-var resourceLimitCategory = map[byte]string {
-	0: "application",
-	1: "sysapplet",
-	2: "libapplet",
-	3: "other",
-}
-
-var memoryType = map[byte]string {
-	1: "Application",
-	2: "System",
-	3: "Base",
-}
-
-var svcs = []string {
-	"",                                  // 00
-	"ControlMemory",                     // 01
-	"QueryMemory",                       // 02
-	"ExitProcess",                       // 03
-	"GetProcessAffinityMask",            // 04
-	"SetProcessAffinityMask",            // 05
-	"GetProcessIdealProcessor",          // 06
-	"SetProcessIdealProcessor",          // 07
-	"CreateThread",                      // 08
-	"ExitThread",                        // 09
-	"SleepThread",                       // 0A
-	"GetThreadPriority",                 // 0B
-	"SetThreadPriority",                 // 0C
-	"GetThreadAffinityMask",             // 0D
-	"SetThreadAffinityMask",             // 0E
-	"GetThreadIdealProcessor",           // 0F
-	"SetThreadIdealProcessor",           // 10
-	"GetCurrentProcessorNumber",         // 11
-	"Run",                               // 12
-	"CreateMutex",                       // 13
-	"ReleaseMutex",                      // 14
-	"CreateSemaphore",                   // 15
-	"ReleaseSemaphore",                  // 16
-	"CreateEvent",                       // 17
-	"SignalEvent",                       // 18
-	"ClearEvent",                        // 19
-	"CreateTimer",                       // 1A
-	"SetTimer",                          // 1B
-	"CancelTimer",                       // 1C
-	"ClearTimer",                        // 1D
-	"CreateMemoryBlock",                 // 1E
-	"MapMemoryBlock",                    // 1F
-	"UnmapMemoryBlock",                  // 20
-	"CreateAddressArbiter",              // 21
-	"ArbitrateAddress",                  // 22
-	"CloseHandle",                       // 23
-	"WaitSynchronization1",              // 24
-	"WaitSynchronizationN",              // 25
-	"SignalAndWait",                     // 26
-	"DuplicateHandle",                   // 27
-	"GetSystemTick",                     // 28
-	"GetHandleInfo",                     // 29
-	"GetSystemInfo",                     // 2A
-	"GetProcessInfo",                    // 2B
-	"GetThreadInfo",                     // 2C
-	"ConnectToPort",                     // 2D
-	"SendSyncRequest1",                  // 2E
-	"SendSyncRequest2",                  // 2F
-	"SendSyncRequest3",                  // 30
-	"SendSyncRequest4",                  // 31
-	"SendSyncRequest",                   // 32
-	"OpenProcess",                       // 33
-	"OpenThread",                        // 34
-	"GetProcessId",                      // 35
-	"GetProcessIdOfThread",              // 36
-	"GetThreadId",                       // 37
-	"GetResourceLimit",                  // 38
-	"GetResourceLimitLimitValues",       // 39
-	"GetResourceLimitCurrentValues",     // 3A
-	"GetThreadContext",                  // 3B
-	"Break",                             // 3C
-	"OutputDebugString",                 // 3D
-	"ControlPerformanceCounter",         // 3E
-	"",                                  // 3F
-	"",                                  // 40
-	"",                                  // 41
-	"",                                  // 42
-	"",                                  // 43
-	"",                                  // 44
-	"",                                  // 45
-	"",                                  // 46
-	"CreatePort",                        // 47
-	"CreateSessionToPort",               // 48
-	"CreateSession",                     // 49
-	"AcceptSession",                     // 4A
-	"ReplyAndReceive1",                  // 4B
-	"ReplyAndReceive2",                  // 4C
-	"ReplyAndReceive3",                  // 4D
-	"ReplyAndReceive4",                  // 4E
-	"ReplyAndReceive",                   // 4F
-	"BindInterrupt",                     // 50
-	"UnbindInterrupt",                   // 51
-	"InvalidateProcessDataCache",        // 52
-	"StoreProcessDataCache",             // 53
-	"FlushProcessDataCache",             // 54
-	"StartInterProcessDma",              // 55
-	"StopDma",                           // 56
-	"GetDmaState",                       // 57
-	"RestartDma",                        // 58
-	"SetGpuProt",                        // 59
-	"SetWifiEnabled",                    // 5A
-	"",                                  // 5B
-	"",                                  // 5C
-	"",                                  // 5D
-	"",                                  // 5E
-	"",                                  // 5F
-	"DebugActiveProcess",                // 60
-	"BreakDebugProcess",                 // 61
-	"TerminateDebugProcess",             // 62
-	"GetProcessDebugEvent",              // 63
-	"ContinueDebugEvent",                // 64
-	"GetProcessList",                    // 65
-	"GetThreadList",                     // 66
-	"GetDebugThreadContext",             // 67
-	"SetDebugThreadContext",             // 68
-	"QueryDebugProcessMemory",           // 69
-	"ReadProcessMemory",                 // 6A
-	"WriteProcessMemory",                // 6B
-	"SetHardwareBreakPoint",             // 6C
-	"GetDebugThreadParam",               // 6D
-	"",                                  // 6E
-	"",                                  // 6F
-	"ControlProcessMemory",              // 70
-	"MapProcessMemory",                  // 71
-	"UnmapProcessMemory",                // 72
-	"CreateCodeSet",                     // 73
-	"",                                  // 74
-	"CreateProcess",                     // 75
-	"TerminateProcess",                  // 76
-	"SetProcessResourceLimits",          // 77
-	"CreateResourceLimit",               // 78
-	"SetResourceLimitValues",            // 79
-	"AddCodeSegment",                    // 7A
-	"Backdoor",                          // 7B
-	"KernelSetState",                    // 7C
-	"QueryProcessMemory",                // 7D
-	"",                                  // 7E
-	"",                                  // 7F
-}
-
-var dependencies = map[uint64]string {
-	0x0004013000002402: "ac",
-	0x0004013000003802: "act",
-	0x0004013000001502: "am",
-	0x0004013000003402: "boss",
-	0x0004013000001602: "camera",
-	0x0004013000002602: "cecd",
-	0x0004013000001702: "cfg",
-	0x0004013000001802: "codec",
-	0x0004013000002702: "csnd",
-	0x0004013000002802: "dlp",
-	0x0004013000001a02: "dsp",
-	0x0004013000003202: "friends",
-	0x0004013000001b02: "gpio",
-	0x0004013000001c02: "gsp",
-	0x0004013000001d02: "hid",
-	0x0004013000002902: "http",
-	0x0004013000001e02: "i2c",
-	0x0004013000003302: "ir",
-	0x0004013000001f02: "mcu",
-	0x0004013000002002: "mic",
-	0x0004013000002b02: "ndm",
-	0x0004013000003502: "news",
-	0x0004013000004002: "nfc",
-	0x0004013000002c02: "nim",
-	0x0004013000002d02: "nwm",
-	0x0004013000002102: "pdn",
-	0x0004013000003102: "ps",
-	0x0004013000002202: "ptm",
-	0x0004013020004202: "qtm",
-	0x0004013000003702: "ro",
-	0x0004013000002e02: "socket",
-	0x0004013000002302: "spi",
-	0x0004013000002f02: "ssl",
-}
+// Exit statuses.
+const (
+	exitOk = 0
+	exitFindings = 1 // Differences, lint problems or failed batch files were found
+	exitUsage = 2 // Invalid command line
+	exitError = 3 // An input could not be read or converted, or an output written
+)
 
 func check(err error) {
 	if (err != nil) {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
 	}
 }
 
-func parseExheader(rsf *Rsf, exheader []byte) {
-	sci := exheader[0:0x200]
-
-	basicInfo := &rsf.BasicInfo
-	titleInfo := &rsf.TitleInfo
-	option := &rsf.Option
-	accessControlInfo := &rsf.AccessControlInfo
-	systemControlInfo := &rsf.SystemControlInfo
-
-	basicInfo.Title = string(bytes.Trim(sci[0:8], "\x00"))
+// Prints message and the command's usage, and exits.
+func usageError(flags *flag.FlagSet, message string) {
+	fmt.Fprintln(os.Stderr, message)
+	flags.Usage()
+	os.Exit(exitUsage)
+}
 
-	option.EnableCompress = (sci[0xD] & (1 << 0)) != 0
-	option.UseOnSD = (sci[0xD] & (1 << 1)) != 0
+// An input read at random offsets, and as a stream for .rsf files.
+type inputFile interface {
+	io.Reader
+	io.ReaderAt
+	io.Closer
+}
 
-	systemControlInfo.RemasterVersion = binary.LittleEndian.Uint16(sci[0xE:])
+type memoryFile struct {
+	*bytes.Reader
+}
 
-	systemControlInfo.StackSize = binary.LittleEndian.Uint32(sci[0x1C:])
+func (memoryFile) Close() error {
+	return nil
+}
 
-	for i := 0; i < 0x30; i++ {
-		tid := binary.LittleEndian.Uint64(sci[0x40 + i * 8:])
-		if (tid == 0) {
-			break
-		}
-		systemControlInfo.Dependency = append(systemControlInfo.Dependency, tid)
+// Opens path, or standard input when path is "-". Standard input is read into
+// memory, as containers are read at random offsets.
+func openInput(path string) (inputFile, error) {
+	if (path != "-") {
+		return os.Open(path)
 	}
-
-	systemControlInfo.SaveDataSize = binary.LittleEndian.Uint64(sci[0x1C0:])
-	systemControlInfo.JumpId = binary.LittleEndian.Uint64(sci[0x1C8:])
-	
-	aci := exheader[0x200:0x400]
-
-	tid := binary.LittleEndian.Uint64(aci[0:])
-	titleInfo.UniqueId = uint32((tid >> 8) & 0xFFFFFF)
-	titleInfo.Category = category[uint16(tid >> 32)]
-	switch(titleInfo.Category) {
-		case "Demo":
-			titleInfo.DemoIndex = uint8(tid)
-		case "DlpChild":
-			titleInfo.ChildIndex = uint8(tid)
-		case "AddOnContents":
-			titleInfo.Variation = uint8(tid)
-		case "IsContents":
-			titleInfo.ContentsIndex = uint8(tid)
+	data, err := io.ReadAll(os.Stdin)
+	if (err != nil) {
+		return nil, err
 	}
-	titleInfo.Version = uint8(tid)
+	return memoryFile{bytes.NewReader(data)}, nil
+}
 
+type stdout struct {
+	io.Writer
+}
 
+func (stdout) Close() error {
+	return nil
+}
 
-	accessControlInfo.CoreVersion = binary.LittleEndian.Uint16(aci[8:])
-	
-	if ((aci[0xC] & 0b10) != 0) {
-		accessControlInfo.CpuSpeed = "804MHz"
-	} else {
-		accessControlInfo.CpuSpeed = "268MHz"
+// Creates path, or returns standard output when path is "-".
+func createOutput(path string) (io.WriteCloser, error) {
+	if (path == "-") {
+		return stdout{os.Stdout}, nil
 	}
+	return os.Create(path)
+}
 
-	accessControlInfo.SystemModeExt = new3dsSystemMode[aci[0xC] & 0b1111]
-	
-	accessControlInfo.EnableL2Cache = (aci[0xC] & 1) != 0
-
-	accessControlInfo.AffinityMask = aci[0xE] >> 2 & 0b11
-	
-	accessControlInfo.IdealProcessor = aci[0xE] & 0b11
-
-	accessControlInfo.SystemMode = old3dsSystemMode[(aci[0xE] >> 4) & 0b1111]
-
-	accessControlInfo.Priority = aci[0xF]
-
-	accessControlInfo.MaxCpu = uint8(aci[0x10])
-
-	accessControlInfo.UseOtherVariationSaveData = ((binary.LittleEndian.Uint64(aci[0x40:]) >> 60) & 0x1) != 0
+// A converted NCCH with the raw structures it was built from.
+type title struct {
+	rsf *rsf.Rsf
+	header *ncch.Header
+	exheader *exheader.Exheader // nil for CFAs
+	logo []byte // Set when the logo is unknown and has to be extracted
+	warnings []string
+}
 
-	if !((aci[0x4F] & 1) != 0) { // Not use ROMFS
-		rsf.RomFs.RootPath = "assets/romfs"
+func printWarnings(warnings []string) {
+	for i := 0; i < len(warnings); i++ {
+		fmt.Fprintln(os.Stderr, "Warning: " + warnings[i])
 	}
+}
 
-	if ((aci[0x4F] & 0b10) != 0) { // Use Extended savedata access.
-		for i := 2; i >= 0; i-- {
-			id := (binary.LittleEndian.Uint64(aci[0x40:]) >> (20 * i)) & 0xFFFFF
-			if (id == 0) {
-				break
-			}
-			accessControlInfo.AccessibleSaveDataIds = append(accessControlInfo.AccessibleSaveDataIds, uint32(id))
-		}
-		for i := 2; i >= 0; i-- {
-			id := (binary.LittleEndian.Uint64(aci[0x30:]) >> (20 * i)) & 0xFFFFF
-			if (id == 0) {
-				break
-			}
-			accessControlInfo.AccessibleSaveDataIds = append(accessControlInfo.AccessibleSaveDataIds, uint32(id))
-		}
-	} else {
-		if (binary.LittleEndian.Uint64(aci[0x30:]) != 0) {
-			accessControlInfo.UseExtSaveData = true
-			accessControlInfo.ExtSaveDataId = binary.LittleEndian.Uint32(aci[0x30:])
-		}
-		for i := 2; i >= 0; i-- {
-			value := uint32((binary.LittleEndian.Uint64(aci[0x40:]) >> (i * 20)) & 0xFFFFF)
-			if (value != 0) {
-				if (accessControlInfo.OtherUserSaveDataId1 == 0) {
-					accessControlInfo.OtherUserSaveDataId1 = value
-				} else if (accessControlInfo.OtherUserSaveDataId2 == 0) {
-					accessControlInfo.OtherUserSaveDataId2 = value
-				} else {
-					accessControlInfo.OtherUserSaveDataId3 = value
-				}
-			}
-		}
+// Converts the NCCH at offset as rsf.Convert does, collecting its warnings.
+func readTitle(in io.ReaderAt, offset int64, read *readOptions) (*title, error) {
+	t := &title{}
+	options := &rsf.Options{Crypto: read.crypto, Force: read.force, Logos: read.logos, SvcNames: read.svcNames,
+		Warn: func(message string) { t.warnings = append(t.warnings, message) }}
+	converted, err := rsf.Convert(in, offset, options)
+	var mismatch *errs.HashMismatchError
+	if (errors.As(err, &mismatch)) {
+		return nil, fmt.Errorf("%v The exheader is corrupted or still encrypted, use -force to convert it anyway.", err)
+	}
+	if (err != nil) {
+		return nil, err
 	}
+	t.rsf, t.header, t.exheader, t.logo = converted.Rsf, converted.Header, converted.Exheader, converted.Logo
+	return t, nil
+}
 
-	accessControlInfo.SystemSaveDataId1 = binary.LittleEndian.Uint32(aci[0x38:])
-	accessControlInfo.SystemSaveDataId2 = binary.LittleEndian.Uint32(aci[0x3C:])
+// How converted titles are written.
+type outputOptions struct {
+	format string // "rsf" or "json"
+	template *template.Template // Used instead of the default RSF layout when set
+}
 
-	accessControlInfo.FileSystemAccess = binary.LittleEndian.Uint32(aci[0x48:])
+// Flags choosing how titles are written.
+type outputFlags struct {
+	format *string
+	templateName *string
+}
 
-	for i := 0; i < 34; i++ {
-		serviceName := string(bytes.Trim(aci[0x50 + i * 8:0x58 + i * 8], "\x00"))
-		if (serviceName == "") {
-			break
-		}
-		accessControlInfo.ServiceAccessControl = append(accessControlInfo.ServiceAccessControl, serviceName)
-	}
+func addOutputFlags(flags *flag.FlagSet) *outputFlags {
+	output := &outputFlags{}
+	output.format = flags.String("format", "rsf", "Output format: rsf or json")
+	output.templateName = flags.String("template", "", "Write the RSF through a template: " + strings.Join(rsf.TemplateNames, ", ") + " or a template file")
+	return output
+}
 
-	accessControlInfo.ResourceLimitCategory = resourceLimitCategory[aci[0x16F]]
-	if (accessControlInfo.ResourceLimitCategory == "application") {
-		accessControlInfo.Priority -= 32
-		systemControlInfo.AppType = "application"
-	} else {
-		systemControlInfo.AppType = "system"
+func (output *outputFlags) options(flags *flag.FlagSet) *outputOptions {
+	if (*output.format != "rsf" && *output.format != "json") {
+		usageError(flags, fmt.Sprintf("Unknown format %q.", *output.format))
 	}
-
-	arm11KernelCapabilities := aci[0x170:]
-	for i := 0; i < 28; i++ {
-		descriptor := binary.LittleEndian.Uint32(arm11KernelCapabilities[i * 4:])
-		var descriptorType uint32
-		for j := 31; j >= 0; j-- {
-			k := descriptor & (1 << j)
-			if (k == 0) {
-				break
-			}
-			descriptorType |= k
-		}
-
-		switch (descriptorType) {
-			case 0xE0000000: // Interrupt
-				for j := 3; j >= 0; j-- {
-					interrupt := (descriptor >> (j * 7)) & 0b1111111
-					if (interrupt != 0) {
-						accessControlInfo.InterruptNumbers = append(accessControlInfo.InterruptNumbers, uint8(interrupt))
-					}
-				}
-			case 0xF0000000: // System Call Access
-				index := (descriptor >> 24) & 0b111
-				for j := 0; j < 24; j++ {
-					if ((descriptor >> j) & 1 != 0) {
-						accessControlInfo.SystemCallAccess = append(accessControlInfo.SystemCallAccess, uint32(j) + 24 * index)
-					}
-				}
- 			case 0xFC000000: // Kernel Version
-				accessControlInfo.ReleaseKernelMajor = uint8((descriptor >> 8) & 0xFF)
-				accessControlInfo.ReleaseKernelMinor = uint8(descriptor & 0xFF )
-			case 0xFE000000: // Handle Table Size
-				accessControlInfo.HandleTableSize = descriptor & 0x7FFFF
-			case 0xFF000000: // Other Capabilities
-				accessControlInfo.DisableDebug = !((descriptor & (1 << 0)) != 0)
-				accessControlInfo.EnableForceDebug = ((descriptor & (1 << 1)) != 0)
-				accessControlInfo.CanUseNonAlphabetAndNumber = ((descriptor & (1 << 2)) != 0)
-				accessControlInfo.CanWriteSharedPage = ((descriptor & (1 << 3)) != 0)
-				accessControlInfo.CanUsePrivilegedPriority = ((descriptor & (1 << 4)) != 0)
-				accessControlInfo.PermitMainFunctionArgument = ((descriptor & (1 << 5)) != 0)
-				accessControlInfo.CanShareDeviceMemory = ((descriptor & (1 << 6)) != 0)
-				accessControlInfo.RunnableOnSleep = ((descriptor & (1 << 7)) != 0)
-				accessControlInfo.MemoryType = memoryType[byte((descriptor >> 8) & 0b1111)]
-				accessControlInfo.SpecialMemoryArrange = ((descriptor & (1 << 12)) != 0)
-				accessControlInfo.CanAccessCore2 = ((descriptor & (1 << 13)) != 0)
-			case 0xFF800000: // Memory Mapping
-				start := descriptor & 0xFFFFF
-				i += 1
-				end := binary.LittleEndian.Uint32(arm11KernelCapabilities[i * 4:])
-				staticMap := (end & (1 << 20)) != 0 
-				end &= 0xFFFFF
-				start <<= 12
-				end <<= 12
-				end -= 0x1
-
-				if (staticMap) { // MemoryMapping
-					if ((descriptor & (1 << 20)) != 0) { // :r
-						accessControlInfo.MemoryMapping = append(accessControlInfo.MemoryMapping, fmt.Sprintf("%x-%x:r", start, end))
-					} else {
-						accessControlInfo.MemoryMapping = append(accessControlInfo.MemoryMapping, fmt.Sprintf("%x-%x", start, end))
-					}
-				} else { // IORegisterMapping
-					accessControlInfo.IORegisterMapping = append(accessControlInfo.IORegisterMapping, fmt.Sprintf("%x-%x", start, end))
-				}
-			case 0xFFC00000:
-		}
+	if (*output.templateName != "" && *output.format != "rsf") {
+		usageError(flags, "-template only applies to -format rsf.")
 	}
- 
-	arm9AccessControl := aci[0x1F0:]
-
-	descriptors := binary.LittleEndian.Uint32(arm9AccessControl)
-
-	if ((descriptors & (1 << 0)) != 0) {
-		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "FsMountNand")
+	options := &outputOptions{format: *output.format}
+	if (*output.templateName != "") {
+		var err error
+		options.template, err = rsf.LoadTemplate(*output.templateName)
+		check(err)
 	}
-	if ((descriptors & (1 << 1)) != 0) {
-		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "FsMountNandRoWrite")
+	return options
+}
+
+// Writes an unknown logo beside the output, for makerom -logo. Nothing is
+// written beside standard output or a device such as /dev/null.
+func extractLogo(t *title, outPath string) error {
+	if (t.logo == nil) {
+		return nil
 	}
-	if ((descriptors & (1 << 2)) != 0) {
-		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "FsMountTwln")
+	if (outPath == "-") {
+		t.warnings = append(t.warnings, "The logo is unknown and is not extracted when writing to standard output.")
+		return nil
 	}
-	if ((descriptors & (1 << 3)) != 0) {
-		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "FsMountWnand")
+	if info, err := os.Stat(outPath); err == nil && !info.Mode().IsRegular() {
+		t.warnings = append(t.warnings, fmt.Sprintf("The logo is unknown and is not extracted beside %s, which is not a regular file.", outPath))
+		return nil
 	}
-	if ((descriptors & (1 << 4)) != 0) {
-		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "FsMountCardSpi")
+	logoPath := strings.TrimSuffix(outPath, filepath.Ext(outPath)) + ".logo.bin"
+	err := os.WriteFile(logoPath, t.logo, 0644)
+	if (err != nil) {
+		return err
 	}
-	if ((descriptors & (1 << 5)) != 0) {
-		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "UseSdif3")
+	t.rsf.LogoFile = filepath.Base(logoPath)
+	return nil
+}
+
+func writeTitle(t *title, outPath string, output *outputOptions) error {
+	err := extractLogo(t, outPath)
+	if (err != nil) {
+		return err
 	}
-	if ((descriptors & (1 << 6)) != 0) {
-		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "CreateSeed")
+	file, err := createOutput(outPath)
+	if (err != nil) {
+		return err
 	}
-	if ((descriptors & (1 << 7)) != 0) {
-		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "UseCardSpi")
+
+	switch {
+		case output.format == "json":
+			err = rsf.WriteJson(file, t.rsf, t.header, t.exheader)
+		case output.template != nil:
+			err = rsf.WriteTemplate(file, t.rsf, output.template)
+		default:
+			err = rsf.Write(file, t.rsf)
 	}
-	if ((descriptors & (1 << 8)) != 0) {
-		option.UseOnSD = true;
+	if (err != nil) {
+		file.Close()
+		return err
 	}
+	return file.Close()
+}
 
-	accessControlInfo.DescVersion = arm9AccessControl[0xF]
+// Flags shared by every command reading a CXI, NCSD or CIA.
+type inputOptions struct {
+	partition *string
+	content *uint
+	keysPath *string
+	seedDbPath *string
+	seedHex *string
+	force *bool
+	logosPath *string
+	svcsPath *string
+	allPartitions bool // -partition all is accepted
 }
 
-func parseNcchHeader(rsf *Rsf, header []byte) {
-	basicInfo := &rsf.BasicInfo
-	titleInfo := &rsf.TitleInfo
-	option := &rsf.Option
+// Adds the input options to flags. allPartitions is set for commands that
+// convert every partition with -partition all.
+func addInputFlags(flags *flag.FlagSet, allPartitions bool) *inputOptions {
+	options := &inputOptions{allPartitions: allPartitions}
+	partitions := "0-7, game, manual, dlp, n3dsupdate or update"
+	if (allPartitions) {
+		partitions = "0-7, game, manual, dlp, n3dsupdate, update or all"
+	}
+	options.partition = flags.String("partition", "game", "NCSD partition to convert: " + partitions)
+	options.content = flags.Uint("content", 0, "CIA content index to convert")
+	options.keysPath = flags.String("keys", "", "AES keys file used to decrypt encrypted NCCHs")
+	options.seedDbPath = flags.String("seeddb", "", "seeddb.bin used for titles with seed crypto")
+	options.seedHex = flags.String("seed", "", "Seed used for titles with seed crypto, as 16 hex-encoded bytes")
+	options.logosPath = flags.String("logos", "", "File of logo hashes to add to the built-in ones, one <name>=<SHA-256> per line")
+	options.svcsPath = flags.String("svcs", "", "File of system call names, one <ID>=<name> per line, replacing the built in names")
+	options.force = flags.Bool("force", false, "Convert even if the exheader does not match its hash in the NCCH header")
+	return options
+}
 
-	option.EnableCrypt = !((header[0x18F] & 4) != 0)
+// How titles are read, built from the input options.
+type readOptions struct {
+	crypto *ncch.CryptoConfig
+	logos ncch.Logos // Hashes of the logos makerom builds in
+	force bool // Only warn when the exheader does not match its hash
+	svcNames *rsf.SvcNames // From -svcs, nil for the built-in names
+}
 
-	option.FreeProductCode = false
-	productCode := header[0x150:0x160]
-	basicInfo.ProductCode = string(bytes.Trim(productCode, "\x00"))
-	if (string(productCode[0:3]) != "CTR" && string(productCode[0:3]) != "KTR") {
-		option.FreeProductCode = true
-	} else {
-		for i := 3; i < 10; i++ {
-			if (i == 3 || i == 5) {
-				if (rune(productCode[i]) != '-') {
-					option.FreeProductCode = true
-					break
-				}
-			} else {
-				if (!unicode.IsDigit(rune(productCode[i])) && !unicode.IsLetter(rune(productCode[i]))) {
-					option.FreeProductCode = true
-					break
-				}
-			}
+// Checks the input options and builds the read options.
+func (options *inputOptions) readOptions(flags *flag.FlagSet) *readOptions {
+	if (*options.partition == "all") {
+		if (!options.allPartitions) {
+			usageError(flags, "-partition all is only supported when converting.")
 		}
+	} else if _, err := ncsd.PartitionIndex(*options.partition); err != nil {
+		usageError(flags, err.Error())
 	}
+	read := &readOptions{crypto: options.cryptoConfig(), logos: ncch.BuiltinLogos(), force: *options.force}
+	if (*options.logosPath != "") {
+		var err error
+		read.logos, err = ncch.LoadLogos(*options.logosPath)
+		check(err)
+	}
+	if (*options.svcsPath != "") {
+		var err error
+		read.svcNames, err = rsf.LoadSvcNames(*options.svcsPath)
+		check(err)
+	}
+	return read
+}
 
-	basicInfo.CompanyCode = string(header[0x110:0x112])
-
-	if (header[0x18C] == 1) {
-		titleInfo.Platform = "CTR"
-	} else if (header[0x18C] == 2) {
-		titleInfo.Platform = "snake"
+func (options *inputOptions) cryptoConfig() *ncch.CryptoConfig {
+	config := &ncch.CryptoConfig{}
+	if (*options.keysPath != "") {
+		var err error
+		config.Keys, err = ncch.LoadKeys(*options.keysPath)
+		check(err)
+	}
+	if (*options.seedDbPath != "") {
+		var err error
+		config.Seeds, err = ncch.LoadSeedDb(*options.seedDbPath)
+		check(err)
+	}
+	if (*options.seedHex != "") {
+		seed, err := hexenc.DecodeString(*options.seedHex)
+		if (err != nil || len(seed) != 0x10) {
+			fmt.Fprintln(os.Stderr, "Seed must be 16 hex-encoded bytes.")
+			os.Exit(exitUsage)
+		}
+		config.Seed = seed
 	}
+	return config
+}
 
-	switch(header[0x18D] >> 2) {
-		case 0:
-			basicInfo.ContentType = "Application"
-		case 1:
-			basicInfo.ContentType = "SystemUpdate"
-		case 2:
-			basicInfo.ContentType = "Manual"
-		case 3:
-			basicInfo.ContentType = "Child"
-		case 4:
-			basicInfo.ContentType = "Trial"
-		case 5:
-			basicInfo.ContentType = "ExtendedSystemUpdate"
+// Finds the selected NCCH in a plain NCCH, NCSD or CIA. ciaFile is set for CIAs.
+func (options *inputOptions) locate(in io.ReaderAt) (offset int64, ciaFile *cia.File, err error) {
+	header := make([]byte, ncch.HeaderSize)
+	in.ReadAt(header, 0)
+	if (cia.Match(header)) {
+		ciaFile, err := cia.Parse(in)
+		if (err != nil) {
+			return 0, nil, err
+		}
+		content, err := ciaFile.Content(uint16(*options.content))
+		if (err != nil) {
+			return 0, nil, err
+		}
+		return content.Offset, ciaFile, nil
+	}
+	if (!ncsd.Match(header)) { // Plain NCCH
+		return 0, nil, nil
 	}
 
-	if (binary.LittleEndian.Uint32(header[0x19c:]) != 0) { // Could probably check hash to determine actual logo, but I don't want to.
-		basicInfo.Logo = "Homebrew"
-	} else {
-		basicInfo.Logo = "None"
+	partitions := ncsd.Partitions(header)
+	index, err := ncsd.PartitionIndex(*options.partition)
+	if (err != nil) {
+		return 0, nil, err
+	}
+	if (partitions[index].Size == 0) {
+		return 0, nil, fmt.Errorf("Partition %s is not present.", ncsd.PartitionName(index))
 	}
+	return partitions[index].Offset, nil, nil
 }
 
-type OutFile struct {
-	*os.File
+func convertNcch(in io.ReaderAt, offset int64, outPath string, read *readOptions, output *outputOptions) ([]string, error) {
+	t, err := readTitle(in, offset, read)
+	if (err != nil) {
+		return nil, err
+	}
+	err = writeTitle(t, outPath, output)
+	return t.warnings, err
 }
 
-func (out *OutFile) WriteTitle(title string, level int) {
-	for i := 0; i < level; i++ {
-		out.WriteString("  ")
+// Returns the warnings from cross-checking the TMD, which is only done against content 0.
+func convertCia(in io.ReaderAt, ciaFile *cia.File, offset int64, outPath string, read *readOptions, output *outputOptions, crossCheck bool) ([]string, error) {
+	t, err := readTitle(in, offset, read)
+	if (err != nil) {
+		return nil, err
 	}
-	out.WriteString(title + ":\n")
+	err = writeTitle(t, outPath, output)
+	if (crossCheck) {
+		t.warnings = append(t.warnings, ciaFile.CrossCheck(t.rsf, t.header.ProgramId)...)
+	}
+	return t.warnings, err
 }
 
-func (out *OutFile) WriteInfo(title string, value string, level int) {
-	for i := 0; i < level; i++ {
-		out.WriteString("  ")
+// Converts the selected NCCH of the file at inPath, or every partition of an
+// NCSD with -partition all. Returns the warnings found while converting.
+func convertFile(inPath string, outPath string, options *inputOptions, read *readOptions, output *outputOptions) ([]string, error) {
+	in, err := openInput(inPath)
+	if (err != nil) {
+		return nil, err
+	}
+	defer in.Close()
+
+	header := make([]byte, ncch.HeaderSize)
+	in.ReadAt(header, 0)
+	if (ncsd.Match(header) && *options.partition == "all") {
+		partitions := ncsd.Partitions(header)
+		var warnings []string
+		for i := 0; i < len(partitions); i++ {
+			if (partitions[i].Size == 0) {
+				continue
+			}
+			partitionWarnings, err := convertNcch(in, partitions[i].Offset, partitionOutPath(outPath, i), read, output)
+			if (err != nil) {
+				return nil, err
+			}
+			for j := 0; j < len(partitionWarnings); j++ {
+				warnings = append(warnings, ncsd.PartitionName(i) + ": " + partitionWarnings[j])
+			}
+		}
+		return warnings, nil
 	}
-	out.WriteString(title + " : " + value + "\n")
-}
 
-func (out *OutFile) WriteItem(value string, level int) {
-	for i := 0; i < level; i++ {
-		out.WriteString("  ")
+	offset, ciaFile, err := options.locate(in)
+	if (err != nil) {
+		return nil, err
+	}
+	if (ciaFile != nil) {
+		return convertCia(in, ciaFile, offset, outPath, read, output, *options.content == 0)
 	}
-	out.WriteString(" - " + value + "\n")
+	return convertNcch(in, offset, outPath, read, output)
 }
 
-func quotes(in string)(out string) {
-	out = fmt.Sprintf("\"%s\"", in)
-	return
-}
+// Values for $(NAME) in RSFs, given as repeated -D NAME=VALUE flags.
+type varsFlag map[string]string
 
-func hex(in interface{})(out string) {
-	out = fmt.Sprintf("0x%x", in)
-	return
+func (vars varsFlag) String() string {
+	return ""
 }
 
-func hexFill(in interface{}, length int)(out string) {
-	out = fmt.Sprintf("0x%0*x", length, in)
-	return
+func (vars varsFlag) Set(value string) error {
+	eq := strings.IndexByte(value, '=')
+	if (eq <= 0) {
+		return fmt.Errorf("expected NAME=VALUE")
+	}
+	vars[value[:eq]] = value[eq + 1:]
+	return nil
 }
 
-func dec(in interface{})(out string) {
-	out = fmt.Sprintf("%d", in)
-	return
+// Inserts the partition name before the extension, e.g. out.rsf -> out.manual.rsf
+func partitionOutPath(outPath string, index int) string {
+	if (outPath == "-") {
+		return outPath
+	}
+	ext := filepath.Ext(outPath)
+	return strings.TrimSuffix(outPath, ext) + "." + ncsd.PartitionName(index) + ext
 }
 
-func truth(in bool)(out string) {
-	if (in) {
-		out = "true"
-	} else {
-		out = "false"
-	}
-	return
-}
-
-func output(rsf *Rsf, out *OutFile) {
-	var comment string
-
-	basicInfo := &rsf.BasicInfo
-	romFs := &rsf.RomFs
-	titleInfo := &rsf.TitleInfo
-	option := &rsf.Option
-	accessControlInfo := &rsf.AccessControlInfo
-	systemControlInfo := &rsf.SystemControlInfo
-
-	out.WriteTitle("BasicInfo", 0)
-	out.WriteInfo("Title", quotes(basicInfo.Title), 1)
-	out.WriteInfo("CompanyCode", quotes(basicInfo.CompanyCode), 1)
-	out.WriteInfo("ProductCode", quotes(basicInfo.ProductCode), 1)
-	out.WriteInfo("ContentType", quotes(basicInfo.ContentType), 1)
-	comment = " # Nintendo / Licensed / Distributed / iQue / iQueForSystem"
-	out.WriteInfo("Logo", basicInfo.Logo + comment, 1)
-
-	out.WriteString("\n")
-
-	out.WriteTitle("RomFs", 0)
-	rootPathString := "RootPath"
-	if (romFs.RootPath == "") {
-		rootPathString = "#" + rootPathString
-	}
-	out.WriteInfo(rootPathString, romFs.RootPath, 1)
-
-	out.WriteString("\n")
-
-	out.WriteTitle("TitleInfo", 0)
-	out.WriteInfo("Platform", titleInfo.Platform, 1)
-	out.WriteInfo("Category", titleInfo.Category, 1)
-	out.WriteInfo("UniqueId", hexFill(titleInfo.UniqueId, 6), 1)
-	if (titleInfo.ContentsIndex != 0) {
-		out.WriteInfo("ContentsIndex", hexFill(titleInfo.ContentsIndex, 2), 1)
-	} else if (titleInfo.Variation != 0) {
-		out.WriteInfo("Variation", hexFill(titleInfo.Variation, 2), 1)
-	} else if (titleInfo.ChildIndex != 0) {
-		out.WriteInfo("ChildIndex", hexFill(titleInfo.ChildIndex, 2), 1)
-	} else if (titleInfo.DemoIndex != 0) {
-		out.WriteInfo("DemoIndex", hexFill(titleInfo.DemoIndex, 2), 1)
-	} else {
-		out.WriteInfo("Version", hexFill(titleInfo.Version, 2), 1)
+// Converts the input, re-encodes the RSF into an exheader and reports every
+// field that does not survive the round trip.
+func verify(args []string) {
+	flags := newFlagSet("verify")
+	options := addInputFlags(flags, false)
+	flags.Parse(args)
+
+	if (flags.NArg() != 1) {
+		usageError(flags, "Expected one input.")
 	}
+	read := options.readOptions(flags)
 
-	out.WriteString("\n")
+	in, err := openInput(flags.Arg(0))
+	check(err)
+	defer in.Close()
 
-	out.WriteTitle("Option", 0)
-	out.WriteInfo("EnableCrypt", truth(option.EnableCrypt), 1)
-	out.WriteInfo("EnableCompress", truth(option.EnableCompress), 1)
-	out.WriteInfo("FreeProductCode", truth(option.FreeProductCode), 1)
-	out.WriteInfo("UseOnSD", truth(option.UseOnSD), 1)
+	offset, _, err := options.locate(in)
+	check(err)
+	t, err := readTitle(in, offset, read)
+	check(err)
+	printWarnings(t.warnings)
+	if (t.exheader == nil) {
+		check(fmt.Errorf("The NCCH has no exheader to verify."))
+	}
 
-	out.WriteString("\n")
+	encoded, err := t.rsf.Exheader()
+	check(err)
 
-	out.WriteTitle("AccessControlInfo", 0)
-	out.WriteInfo("CoreVersion", dec(accessControlInfo.CoreVersion), 1)
+	differences := exheader.Compare(t.exheader, encoded)
+	for i := 0; i < len(differences); i++ {
+		difference := differences[i]
+		switch {
+			case difference.Encoded == "":
+				fmt.Printf("%s: lost %s\n", difference.Field, difference.Original)
+			case difference.Original == "":
+				fmt.Printf("%s: added %s\n", difference.Field, difference.Encoded)
+			default:
+				fmt.Printf("%s: %s -> %s\n", difference.Field, difference.Original, difference.Encoded)
+		}
+	}
+	if (len(differences) > 0) {
+		fmt.Printf("%d fields do not round-trip.\n", len(differences))
+		os.Exit(exitFindings)
+	}
+	fmt.Println("All fields round-trip.")
+}
 
-	out.WriteString("\n")
+// Reports whether in starts with an NCCH, NCSD or CIA header.
+func isContainer(in io.ReaderAt) bool {
+	header := make([]byte, ncch.HeaderSize)
+	n, _ := in.ReadAt(header, 0)
+	header = header[:n]
+	return ncch.Match(header) || ncsd.Match(header) || cia.Match(header)
+}
 
-	out.WriteString("  # Exheader Format Version\n")
-	out.WriteInfo("DescVersion", dec(accessControlInfo.DescVersion), 1)
+// Reads an .rsf, or converts any other input. Standard input is read as an
+// .rsf unless it starts with a container header.
+func loadRsf(path string, options *inputOptions, read *readOptions, vars varsFlag) *rsf.Rsf {
+	in, err := openInput(path)
+	check(err)
+	defer in.Close()
 
-	out.WriteString("\n")
+	if (strings.EqualFold(filepath.Ext(path), ".rsf") || (path == "-" && !isContainer(in))) {
+		r, err := (&rsf.Reader{Vars: vars}).Read(in)
+		check(err)
+		r.SvcNames = read.svcNames
+		return r
+	}
 
-	out.WriteString("  # Minimum Required Kernel Version\n")
-	out.WriteInfo("ReleaseKernelMajor", quotes(dec(accessControlInfo.ReleaseKernelMajor)), 1)
-	out.WriteInfo("ReleaseKernelMinor", quotes(dec(accessControlInfo.ReleaseKernelMinor)), 1)
+	offset, _, err := options.locate(in)
+	check(err)
+	t, err := readTitle(in, offset, read)
+	check(err)
+	printWarnings(t.warnings)
+	return t.rsf
+}
 
-	out.WriteString("\n")
+// Prints the RSF-level differences between two titles, grouped by section and key.
+func diff(args []string) {
+	flags := newFlagSet("diff")
+	options := addInputFlags(flags, false)
+	vars := varsFlag{}
+	flags.Var(vars, "D", "Define NAME=VALUE for $(NAME) in .rsf inputs")
+	flags.Parse(args)
 
-	out.WriteString("  # ExtData\n")
-	out.WriteInfo("UseExtSaveData", truth(accessControlInfo.UseExtSaveData), 1)
-	str := "ExtSaveDataId"
-	if (!accessControlInfo.UseExtSaveData) {
-		str = "#" + str
+	if (flags.NArg() != 2) {
+		usageError(flags, "Expected two inputs.")
+	}
+	if (flags.Arg(0) == "-" && flags.Arg(1) == "-") {
+		usageError(flags, "Only one input can be read from standard input.")
 	}
-	out.WriteInfo(str, hex(accessControlInfo.ExtSaveDataId), 1)
+	read := options.readOptions(flags)
 
-	out.WriteString("\n")
+	changes := rsf.Diff(loadRsf(flags.Arg(0), options, read, vars), loadRsf(flags.Arg(1), options, read, vars))
+	printChanges(os.Stdout, changes)
+	if (len(changes) > 0) {
+		os.Exit(exitFindings)
+	}
+}
 
-	newline := false
-	if (accessControlInfo.SystemSaveDataId1 != 0) {
-		newline = true
-		out.WriteInfo("SystemSaveDataId1", hex(accessControlInfo.SystemSaveDataId1), 1)
-		if (accessControlInfo.SystemSaveDataId2 != 0) {
-			out.WriteInfo("SystemSaveDataId2", hex(accessControlInfo.SystemSaveDataId2), 1)
+// Prints changes grouped by section and key.
+func printChanges(w io.Writer, changes []rsf.Change) {
+	section, key := "", ""
+	for i := 0; i < len(changes); i++ {
+		change := changes[i]
+		if (change.Section != section) {
+			section, key = change.Section, ""
+			fmt.Fprintln(w, section + ":")
 		}
-	}
-	if (accessControlInfo.OtherUserSaveDataId1 != 0) {
-		newline = true
-		out.WriteInfo("OtherUserSaveDataId1", hex(accessControlInfo.OtherUserSaveDataId1), 1)
-		if (accessControlInfo.OtherUserSaveDataId2 != 0) {
-			out.WriteInfo("OtherUserSaveDataId2", hex(accessControlInfo.OtherUserSaveDataId2), 1)
-			if (accessControlInfo.OtherUserSaveDataId3 != 0) {
-				out.WriteInfo("OtherUserSaveDataId3", hex(accessControlInfo.OtherUserSaveDataId3), 1)
-			}
+		switch {
+			case change.Old != "" && change.New != "":
+				fmt.Fprintf(w, "  %s: %s -> %s\n", change.Key, change.Old, change.New)
+				key = ""
+				continue
+			case change.Key != key:
+				key = change.Key
+				fmt.Fprintf(w, "  %s:\n", key)
 		}
-	}
-	if (len(accessControlInfo.AccessibleSaveDataIds) > 0) {
-		out.WriteTitle("AccessibleSaveDataIds", 1)
-		newline = true
-		for i := 0; i < len(accessControlInfo.AccessibleSaveDataIds); i++ {
-			out.WriteItem(hex(accessControlInfo.AccessibleSaveDataIds[i]), 2)
+		if (change.New != "") {
+			fmt.Fprintf(w, "    + %s\n", change.New)
+		} else {
+			fmt.Fprintf(w, "    - %s\n", change.Old)
 		}
 	}
+}
 
+// Updates the RSF at rsfPath with the values converted from inPath, writing
+// the result to outPath.
+func update(inPath string, options *inputOptions, read *readOptions, rsfPath string, outPath string) {
+	in, err := openInput(inPath)
+	check(err)
+	defer in.Close()
+
+	offset, _, err := options.locate(in)
+	check(err)
+	t, err := readTitle(in, offset, read)
+	check(err)
+	check(extractLogo(t, outPath))
+	printWarnings(t.warnings)
+	existing, err := os.ReadFile(rsfPath)
+	check(err)
+
+	out := &bytes.Buffer{}
+	changes, kept, err := rsf.Update(bytes.NewReader(existing), out, t.rsf)
+	check(err)
+	file, err := createOutput(outPath)
+	check(err)
+	_, err = file.Write(out.Bytes())
+	check(err)
+	check(file.Close())
 
-	if (newline) {
-		out.WriteString("\n")
+	summary := io.Writer(os.Stdout)
+	if (outPath == "-") { // Keep the summary out of the RSF
+		summary = os.Stderr
 	}
-		
-	out.WriteString("  # FS:USER Archive Access Permissions\n")
-	out.WriteString("  # Uncomment as required\n")
-	out.WriteTitle("FileSystemAccess", 1)
-	for i := 0; i <= 21; i++ {
-		if ((accessControlInfo.FileSystemAccess & (1 << i)) == 0) {
-			out.WriteString("#")
-		}
-		out.WriteItem(filesystemAccessInfo[byte(i)], 2)
+	printChanges(summary, changes)
+	for i := 0; i < len(kept); i++ {
+		fmt.Fprintf(summary, "Kept %s, it uses $(NAME).\n", kept[i])
+	}
+	if (len(changes) == 0) {
+		fmt.Fprintln(summary, "No changes.")
+	}
+}
 
+// The default output of convert: the input with its extension replaced.
+func defaultOutPath(inPath string, format string) string {
+	if (inPath == "-") {
+		return "-"
 	}
-	
-	out.WriteString("\n")
+	return strings.TrimSuffix(inPath, filepath.Ext(inPath)) + "." + format
+}
 
-	if (len(accessControlInfo.IoAccessControl) > 0) {
-		out.WriteTitle("IoAccessControl", 1)
-		for i := 0; i < len(accessControlInfo.IoAccessControl); i++ {
-			out.WriteItem(accessControlInfo.IoAccessControl[i], 2)
-		}
-		out.WriteString("\n")
-	}
-
-	out.WriteString("  # Process Settings\n")
-	comment = " # Application/System/Base"
-	out.WriteInfo("MemoryType", accessControlInfo.MemoryType + comment, 1)
-	comment = " # Application/Sysapplet/Libapplet/Other"
-	out.WriteInfo("ResourceLimitCategory", accessControlInfo.ResourceLimitCategory, 1)
-	comment = " # 64MB(Default)/96MB/80MB/72MB/32MB"
-	out.WriteInfo("SystemMode", accessControlInfo.SystemMode + comment, 1)
-	out.WriteInfo("IdealProcessor", dec(accessControlInfo.IdealProcessor), 1)
-	out.WriteInfo("AffinityMask", dec(accessControlInfo.AffinityMask), 1)
-	out.WriteInfo("Priority", dec(accessControlInfo.Priority), 1)
-	out.WriteInfo("MaxCpu", hex(accessControlInfo.MaxCpu), 1)
-	out.WriteInfo("HandleTableSize", hex(accessControlInfo.HandleTableSize), 1)
-
-	out.WriteInfo("DisableDebug", truth(accessControlInfo.DisableDebug), 1)
-	out.WriteInfo("EnableForceDebug", truth(accessControlInfo.EnableForceDebug), 1)
-	out.WriteInfo("CanWriteSharedPage", truth(accessControlInfo.CanWriteSharedPage), 1)
-	out.WriteInfo("CanUsePrivilegedPriority", truth(accessControlInfo.CanUsePrivilegedPriority), 1)
-	out.WriteInfo("CanUseNonAlphabetAndNumber", truth(accessControlInfo.CanUseNonAlphabetAndNumber), 1)
-	out.WriteInfo("PermitMainFunctionArgument", truth(accessControlInfo.PermitMainFunctionArgument), 1)
-	out.WriteInfo("CanShareDeviceMemory", truth(accessControlInfo.CanShareDeviceMemory), 1)
-	out.WriteInfo("UseOtherVariationSaveData", truth(accessControlInfo.UseOtherVariationSaveData), 1)
-	out.WriteInfo("RunnableOnSleep", truth(accessControlInfo.RunnableOnSleep), 1)
-	out.WriteInfo("SpecialMemoryArrange", truth(accessControlInfo.SpecialMemoryArrange), 1)
-
-	out.WriteString("\n")
-
-	comment = " # Legacy(Default)/124MB/178MB  Legacy:Use Old3DS SystemMode"
-	out.WriteInfo("SystemModeExt", accessControlInfo.SystemModeExt + comment, 1)
-	comment = " # 256MHz(Default)/804MHz"
-	out.WriteInfo("CpuSpeed", accessControlInfo.CpuSpeed + comment, 1)
-	comment = " # false(default)/true"
-	out.WriteInfo("EnableL2Cache", truth(accessControlInfo.EnableL2Cache) + comment, 1)
-	out.WriteInfo("CanAccessCore2", truth(accessControlInfo.CanAccessCore2), 1)
-
-	out.WriteString("\n")
-
-	out.WriteTitle("IORegisterMapping", 1)
-	for i := 0; i < len(accessControlInfo.IORegisterMapping); i++ {
-		out.WriteItem(accessControlInfo.IORegisterMapping[i], 2)
-	}
-	out.WriteTitle("MemoryMapping", 1)
-	for i := 0; i < len(accessControlInfo.MemoryMapping); i++ {
-		out.WriteItem(accessControlInfo.MemoryMapping[i], 2)
-	}
-
-	out.WriteString("\n")
-
-	out.WriteString("  # Accessible SVCs, <Name>:<ID>\n")
-	out.WriteTitle("SystemCallAccess", 1)
-	for i := 0; i < len(accessControlInfo.SystemCallAccess); i++ {
-		id := accessControlInfo.SystemCallAccess[i]
-		if (svcs[id] != "") {
-			out.WriteString("    " + svcs[id] + ": " + dec(id) + "\n")
-		}
+func convert(args []string) {
+	flags := newFlagSet("convert")
+	options := addInputFlags(flags, true)
+	outputFlags := addOutputFlags(flags)
+	outPath := flags.String("o", "", "Output file, - for standard output (default: the input with its extension replaced)")
+	updatePath := flags.String("update", "", "Update the values in an existing .rsf instead of writing a new one, keeping its comments and layout")
+	flags.Parse(args)
+
+	if (flags.NArg() == 2 && *outPath == "") { // cxi2rsf <input> <output>
+		*outPath = flags.Arg(1)
+	} else if (flags.NArg() != 1) {
+		usageError(flags, "Expected one input.")
+	}
+	output := outputFlags.options(flags)
+	if (*updatePath != "" && *options.partition == "all") {
+		usageError(flags, "-partition all cannot be used with -update.")
 	}
-	
-	out.WriteString("\n")
+	read := options.readOptions(flags)
 
-	if (len(accessControlInfo.InterruptNumbers) > 0) {
-		out.WriteTitle("InterruptNumbers", 1)
-		for i := 0; i < len(accessControlInfo.InterruptNumbers); i++ {
-			out.WriteItem(hexFill(accessControlInfo.InterruptNumbers, 2), 2)
+	if (*updatePath != "") {
+		if (*outPath == "") {
+			*outPath = *updatePath
 		}
-		out.WriteString("\n")
+		update(flags.Arg(0), options, read, *updatePath, *outPath)
+		return
 	}
+	if (*outPath == "") {
+		*outPath = defaultOutPath(flags.Arg(0), output.format)
+	}
+	if (*options.partition == "all" && *outPath == "-") {
+		usageError(flags, "-partition all writes a file per partition and cannot write to standard output.")
+	}
+
+	warnings, err := convertFile(flags.Arg(0), *outPath, options, read, output)
+	printWarnings(warnings)
+	check(err)
+}
 
-	out.WriteString("  # Service List\n")
-	out.WriteString("  # Maximum 34 services (32 if firmware is prior to 9.6.0)\n")
-	out.WriteTitle("ServiceAccessControl", 1)
-	for i := 0; i < len(accessControlInfo.ServiceAccessControl); i++ {
-		out.WriteItem(accessControlInfo.ServiceAccessControl[i], 2)
+// Reads an .rsf and writes the 0x400-byte exheader makerom would build from it.
+func encode(args []string) {
+	flags := newFlagSet("encode")
+	vars := varsFlag{}
+	flags.Var(vars, "D", "Define NAME=VALUE for $(NAME) in the .rsf")
+	outPath := flags.String("o", "", "Output file, - for standard output (default: the input with its extension replaced by .bin)")
+	flags.Parse(args)
+
+	if (flags.NArg() == 2 && *outPath == "") { // cxi2rsf encode <input> <output>
+		*outPath = flags.Arg(1)
+	} else if (flags.NArg() != 1) {
+		usageError(flags, "Expected one input.")
+	}
+	if (*outPath == "") {
+		*outPath = defaultOutPath(flags.Arg(0), "bin")
 	}
 
-	out.WriteString("\n")
+	in, err := openInput(flags.Arg(0))
+	check(err)
+	defer in.Close()
+
+	r, err := (&rsf.Reader{Vars: vars}).Read(in)
+	check(err)
+	exh, err := r.Exheader()
+	check(err)
 
-	out.WriteTitle("SystemControlInfo", 0)
-	out.WriteInfo("AppType", systemControlInfo.AppType, 1)
-	out.WriteInfo("StackSize", hex(systemControlInfo.StackSize), 1)
-	out.WriteInfo("RemasterVersion", hex(systemControlInfo.RemasterVersion), 1)
-	out.WriteInfo("JumpId", hexFill(systemControlInfo.JumpId, 6), 1)
-	out.WriteInfo("SaveDataSize", dec(systemControlInfo.SaveDataSize) + "KB", 1)
+	out, err := createOutput(*outPath)
+	check(err)
+	_, err = out.Write(exh.Bytes())
+	check(err)
+	check(out.Close())
+}
 
-	out.WriteString("\n")
+// Prints a short summary of the title.
+func info(args []string) {
+	flags := newFlagSet("info")
+	options := addInputFlags(flags, false)
+	flags.Parse(args)
 
-	out.WriteString("  # Modules that run services listed above should be included below\n")
-	out.WriteString("  # Maximum 48 dependencies\n")
-	out.WriteString("  # <module name>:<module titleid>\n")
-	out.WriteTitle("Dependency", 1)
-	for i := 0; i < len(systemControlInfo.Dependency); i++ {
-		id := systemControlInfo.Dependency[i]
-		out.WriteString("    " + dependencies[id] + ": " + hex(id) + "\n")
+	if (flags.NArg() != 1) {
+		usageError(flags, "Expected one input.")
 	}
-}
+	read := options.readOptions(flags)
 
-func main() {
-	in, err := os.Open(os.Args[1])
+	in, err := openInput(flags.Arg(0))
 	check(err)
-	cxi := make([]byte, 0x600)
-	n, err := in.Read(cxi)
+	defer in.Close()
+
+	offset, _, err := options.locate(in)
 	check(err)
-	in.Close()
+	t, err := readTitle(in, offset, read)
+	check(err)
+	printWarnings(t.warnings)
+
+	r := t.rsf
+	accessControlInfo := &r.AccessControlInfo
+	field := func(name string, format string, values ...interface{}) {
+		fmt.Printf("%-14s" + format + "\n", append([]interface{}{name + ":"}, values...)...)
+	}
+	field("Title ID", "%016x", t.header.ProgramId)
+	field("Title", "%s", r.BasicInfo.Title)
+	field("Product code", "%s", r.BasicInfo.ProductCode)
+	field("Category", "%s", r.TitleInfo.Category)
+	field("Content type", "%s", r.BasicInfo.ContentType)
+	field("Platform", "%s", r.TitleInfo.Platform)
+	if (!r.Cfa) {
+		field("Remaster", "%d", r.SystemControlInfo.RemasterVersion)
+		field("Memory", "%s, %s on New 3DS, %s memory", accessControlInfo.SystemMode, accessControlInfo.SystemModeExt, accessControlInfo.MemoryType)
+		l2Cache := ""
+		if (accessControlInfo.EnableL2Cache) {
+			l2Cache = " with L2 cache"
+		}
+		field("CPU speed", "%s%s on New 3DS", accessControlInfo.CpuSpeed, l2Cache)
+	}
+	if (t.header.RomfsSize != 0) {
+		field("RomFS", "0x%x bytes", uint64(t.header.RomfsSize) * ncch.MediaUnit)
+	} else {
+		field("RomFS", "None")
+	}
+	field("Encryption", "%s", t.header.Encryption())
+	if (t.logo != nil) {
+		field("Logo", "Unknown, SHA-256 %x", sha256.Sum256(t.logo))
+	} else {
+		field("Logo", "%s", r.BasicInfo.Logo)
+	}
+	if (r.Cfa) {
+		field("Exheader", "None (CFA)")
+		return
+	}
+	field("Dependencies", "%d", len(r.SystemControlInfo.Dependency))
+	field("Services", "%d: %s", len(accessControlInfo.ServiceAccessControl), strings.Join(accessControlInfo.ServiceAccessControl, ", "))
+}
 
-	if (n != 0x600) {
-		fmt.Println("Invalid .cxi file.")
-		os.Exit(1)
+// Checks an .rsf for problems makerom would reject or silently work around.
+func lint(args []string) {
+	flags := newFlagSet("lint")
+	vars := varsFlag{}
+	flags.Var(vars, "D", "Define NAME=VALUE for $(NAME) in the .rsf")
+	flags.Parse(args)
+
+	if (flags.NArg() != 1) {
+		usageError(flags, "Expected one input.")
 	}
 
-	file, err := os.Create(os.Args[2])
+	in, err := openInput(flags.Arg(0))
+	check(err)
+	defer in.Close()
+
+	reader := &rsf.Reader{Vars: vars}
+	r, err := reader.Read(in)
 	check(err)
 
-	rsf := Rsf{}
-	
-	parseExheader(&rsf, cxi[0x200:])
-	
-	parseNcchHeader(&rsf, cxi[0:])
+	problems := rsf.LintKeys(reader.Unknown)
+	problems = append(problems, rsf.Lint(r)...)
+	for i := 0; i < len(problems); i++ {
+		fmt.Println(problems[i])
+	}
+	if (len(problems) > 0) {
+		os.Exit(exitFindings)
+	}
+	fmt.Println("No problems found.")
+}
 
-	output(&rsf, &OutFile{file})
+type command struct {
+	name string
+	args string
+	summary string
+	run func(args []string)
+}
 
-	file.Close()
+var commands []command
 
-	check(err)
+// Set in init, as the commands' usage text refers back to commands.
+func init() {
+	commands = []command {
+		{"convert", "[options] <input> [<output>]", "Converts a .cxi, .3ds/.cci or .cia into an .rsf, or JSON with -format json.", convert},
+		{"encode", "[options] <input>.rsf [<output>.bin]", "Writes the 0x400-byte exheader makerom would build from an .rsf.", encode},
+		{"info", "[options] <input>", "Prints a summary of a .cxi, .3ds/.cci or .cia.", info},
+		{"verify", "[options] <input>", "Converts the input, encodes the RSF back into an exheader and reports every field that does not round-trip.", verify},
+		{"diff", "[options] <old> <new>", "Compares two titles or .rsf files by RSF section and key.", diff},
+		{"lint", "[options] <input>.rsf", "Checks an .rsf for unknown keys, invalid values and limits makerom enforces.", lint},
+		{"batch", "[options] <input dir> <output dir>", "Converts every title under a directory into a mirrored output tree.", batch},
+		{"extract-exefs", "[options] <input> [<output>]", "Converts the input as convert does and writes every ExeFS file beside the output, .code decompressed as code.bin.", extractExefs},
+	}
+}
+
+func findCommand(name string) *command {
+	for i := 0; i < len(commands); i++ {
+		if (commands[i].name == name) {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// Returns the flag set of a command, with usage text built from commands.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		c := findCommand(name)
+		out := flags.Output()
+		fmt.Fprintf(out, "Usage: cxi2rsf %s %s\n\n%s\n\nOptions:\n", c.name, c.args, c.summary)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: cxi2rsf <command> [options] <arguments>")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for i := 0; i < len(commands); i++ {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", commands[i].name, commands[i].summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun cxi2rsf <command> -help for the options of a command. An input or output of - is standard input or output.")
+	fmt.Fprintln(os.Stderr, "cxi2rsf <input> <output> is short for cxi2rsf convert <input> <output>.")
+	fmt.Fprintln(os.Stderr, "\nExit status: 0 on success, 1 if differences, lint problems or failed batch files were found,")
+	fmt.Fprintln(os.Stderr, "2 for an invalid command line and 3 if an input could not be read or converted.")
+}
+
+func main() {
+	if (len(os.Args) < 2) {
+		usage()
+		os.Exit(exitUsage)
+	}
+	switch os.Args[1] {
+		case "-h", "-help", "--help", "help":
+			usage()
+			os.Exit(exitOk)
+	}
+	c := findCommand(os.Args[1])
+	if (c == nil) { // cxi2rsf [options] <input> <output>
+		convert(os.Args[1:])
+		return
+	}
+	c.run(os.Args[2:])
 }
@@ -0,0 +1,203 @@
+package ncch
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	hexenc "encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// Keys as read from an aes_keys.txt style file, e.g. "slot0x2CKeyX=<hex>".
+type Keys map[string][]byte
+
+type CryptoConfig struct {
+	Keys Keys
+	Seeds map[uint64][]byte // From seeddb.bin, keyed by program ID
+	Seed []byte             // Overrides Seeds
+}
+
+const (
+	SectionExheader = 1
+	SectionExefs = 2
+	SectionRomfs = 3
+)
+
+// Secondary key slot, keyed by the crypto method byte at 0x18B.
+var keySlots = map[byte]string {
+	0x00: "slot0x2CKeyX",
+	0x01: "slot0x25KeyX",
+	0x0A: "slot0x18KeyX",
+	0x0B: "slot0x1BKeyX",
+}
+
+// Names of the crypto methods, as used by makerom and 3dbrew.
+var cryptoMethods = map[byte]string {
+	0x00: "Secure1",
+	0x01: "Secure2",
+	0x0A: "Secure3",
+	0x0B: "Secure4",
+}
+
+// Encryption describes how the NCCH is encrypted, e.g. "Secure2 (slot0x25KeyX) with seed".
+func (header *Header) Encryption() string {
+	switch {
+		case !header.Encrypted():
+			return "None"
+		case header.FixedKey():
+			return "Fixed key"
+	}
+	method := header.Flags[FlagCryptoMethod]
+	name, ok := cryptoMethods[method]
+	if (!ok) {
+		return fmt.Sprintf("Unknown crypto method 0x%02x", method)
+	}
+	description := name + " (" + keySlots[method] + ")"
+	if (header.UsesSeed()) {
+		description += " with seed"
+	}
+	return description
+}
+
+var keyScramblerConstant, _ = new(big.Int).SetString("1FF9E9AAC5FE0408024591DC5D52768A", 16)
+
+// LoadKeys reads an aes_keys.txt style keys file.
+func LoadKeys(path string) (Keys, error) {
+	file, err := os.Open(path)
+	if (err != nil) {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys := Keys{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if (text == "" || text[0] == '#') {
+			continue
+		}
+		eq := strings.IndexByte(text, '=')
+		if (eq < 0) {
+			return nil, fmt.Errorf("%s:%d: expected <name>=<key>", path, line)
+		}
+		key, err := hexenc.DecodeString(strings.TrimSpace(text[eq + 1:]))
+		if (err != nil || len(key) != 0x10) {
+			return nil, fmt.Errorf("%s:%d: key must be 16 hex-encoded bytes", path, line)
+		}
+		keys[strings.TrimSpace(text[:eq])] = key
+	}
+	return keys, scanner.Err()
+}
+
+// Rotates x left by n bits as a 128-bit value. Bits of x above 128, such as
+// the carry of an addition, are dropped first.
+func rol128(x *big.Int, n uint) *big.Int {
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+	x = new(big.Int).And(x, mask)
+	left := new(big.Int).Lsh(x, n)
+	right := new(big.Int).Rsh(x, 128 - n)
+	return left.Or(left, right).And(left, mask)
+}
+
+// NormalKey = (((KeyX <<< 2) ^ KeyY) + C mod 2^128) <<< 87
+func scrambleKey(keyX []byte, keyY []byte) []byte {
+	x := new(big.Int).SetBytes(keyX)
+	y := new(big.Int).SetBytes(keyY)
+	key := rol128(x, 2)
+	key.Xor(key, y)
+	key.Add(key, keyScramblerConstant)
+	key = rol128(key, 87)
+
+	out := make([]byte, 0x10)
+	key.FillBytes(out)
+	return out
+}
+
+type Crypto struct {
+	Primary []byte   // Exheader, ExeFS header, icon and banner
+	Secondary []byte // Remaining ExeFS files and RomFS
+	secondaryErr error
+	header *Header
+}
+
+// NewCrypto builds the keys for the NCCH with the given header. seed may be nil, in which case the secondary key of
+// titles using seed crypto is unavailable.
+func NewCrypto(header *Header, keys Keys, seed []byte) (*Crypto, error) {
+	crypto := &Crypto{header: header}
+
+	if (header.FixedKey()) {
+		if (((header.ProgramId >> 32) & 0x10) != 0) { // System title
+			key, ok := keys["fixedSystemKey"]
+			if (!ok) {
+				return nil, fmt.Errorf("NCCH uses the fixed system key, but fixedSystemKey is not in the keys file.")
+			}
+			crypto.Primary = key
+		} else {
+			crypto.Primary = make([]byte, 0x10)
+		}
+		crypto.Secondary = crypto.Primary
+		return crypto, nil
+	}
+
+	keyY := header.Signature[0:0x10]
+	keyX, ok := keys["slot0x2CKeyX"]
+	if (!ok) {
+		return nil, fmt.Errorf("NCCH is encrypted, but slot0x2CKeyX is not in the keys file.")
+	}
+	crypto.Primary = scrambleKey(keyX, keyY)
+
+	slot, ok := keySlots[header.Flags[FlagCryptoMethod]]
+	if (!ok) {
+		crypto.secondaryErr = fmt.Errorf("Unknown NCCH crypto method 0x%02x.", header.Flags[FlagCryptoMethod])
+		return crypto, nil
+	}
+	keyX, ok = keys[slot]
+	if (!ok) {
+		crypto.secondaryErr = fmt.Errorf("NCCH secondary key requires %s, which is not in the keys file.", slot)
+		return crypto, nil
+	}
+	if (header.UsesSeed()) {
+		if (seed == nil) {
+			crypto.secondaryErr = fmt.Errorf("NCCH uses seed crypto, but no seed is available, use -seeddb or -seed.")
+			return crypto, nil
+		}
+		hash := sha256.Sum256(append(append([]byte{}, keyY...), seed...))
+		keyY = hash[0:0x10]
+	}
+	crypto.Secondary = scrambleKey(keyX, keyY)
+	return crypto, nil
+}
+
+// SecondaryKey returns the key for the ExeFS files other than icon and banner, and the RomFS.
+func (crypto *Crypto) SecondaryKey() ([]byte, error) {
+	return crypto.Secondary, crypto.secondaryErr
+}
+
+// Counter returns the AES-CTR counter for the start of an NCCH section; offset is the section's byte offset within the NCCH.
+func (crypto *Crypto) Counter(section byte, offset uint32) []byte {
+	ctr := make([]byte, 0x10)
+	if (crypto.header.Version == 1) {
+		binary.LittleEndian.PutUint64(ctr[0:], crypto.header.PartitionId)
+		binary.BigEndian.PutUint32(ctr[12:], offset)
+	} else {
+		binary.BigEndian.PutUint64(ctr[0:], crypto.header.PartitionId)
+		ctr[8] = section
+	}
+	return ctr
+}
+
+// AesCtr decrypts or encrypts data in place.
+func AesCtr(key []byte, ctr []byte, data []byte) {
+	block, _ := aes.NewCipher(key)
+	cipher.NewCTR(block, ctr).XORKeyStream(data, data)
+}
+
+// DecryptExheader decrypts the SCI and ACI in place.
+func (crypto *Crypto) DecryptExheader(exheader []byte) {
+	AesCtr(crypto.Primary, crypto.Counter(SectionExheader, 0x200), exheader)
+}
@@ -0,0 +1,29 @@
+package ncch
+
+import (
+	"bytes"
+	hexenc "encoding/hex"
+	"testing"
+)
+
+func TestScrambleKey(t *testing.T) {
+	tests := []struct {
+		keyX, keyY, normal string
+	}{
+		{"00000000000000000000000000000000", "00000000000000000000000000000000", "EE2EA93B450FFCF4D562FF02040122C8"},
+		{"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", "EE2EA93B450FFCF4D562FF02040122C8"},
+		// The sum carries out of 128 bits in the remaining cases.
+		{"00112233445566778899AABBCCDDEEFF", "FFEEDDCCBBAA99887766554433221100", "C3AED410C30FD21F56387E822F2BA348"},
+		{"216363698B529B4A97B750923CEB3FFD", "795B929E9A9A80FDEA7B5BF55EB561A4", "CD05360A6D0E680471BEE778EFDB75D5"},
+		{"633A50EEE0F9E038EB8F624FB804D820", "6D4B9ADBEBCD1F5EC9C18070B6D13089", "955A0A634900CE6185971451E2B520CD"},
+		{"6072C48F60B6CBB1DC98DA8AE58B7C6A", "62DD8A70852380C4DEB135FA75DD67DE", "D720A18680818840FBE6FB5905D78BF8"},
+	}
+	for i := 0; i < len(tests); i++ {
+		keyX, _ := hexenc.DecodeString(tests[i].keyX)
+		keyY, _ := hexenc.DecodeString(tests[i].keyY)
+		normal, _ := hexenc.DecodeString(tests[i].normal)
+		if key := scrambleKey(keyX, keyY); !bytes.Equal(key, normal) {
+			t.Errorf("scrambleKey(%s, %s) = %X, expected %s", tests[i].keyX, tests[i].keyY, key, tests[i].normal)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package ncch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"cxi2rsf/errs"
+)
+
+const ExefsHeaderSize = 0x200
+
+// ExefsFile is an entry of the ExeFS header. Offset is relative to the end of
+// the header.
+type ExefsFile struct {
+	Name string
+	Offset uint32
+	Size uint32
+	Hash [0x20]byte
+}
+
+// Exefs is the ExeFS of an NCCH, read through its header.
+type Exefs struct {
+	Files []ExefsFile
+	in io.ReaderAt
+	offset int64 // Of the ExeFS within in
+	start uint32 // Of the ExeFS within the NCCH
+	crypto *Crypto // nil when the NCCH is not encrypted
+}
+
+// OpenExefs reads the ExeFS header of the NCCH at offset, decrypting it if the
+// NCCH is encrypted. It returns nil if the NCCH has no ExeFS.
+func OpenExefs(in io.ReaderAt, offset int64, header *Header, config *CryptoConfig) (*Exefs, error) {
+	if (header.ExefsSize == 0) {
+		return nil, nil
+	}
+	start := header.ExefsOffset * MediaUnit
+	exefs := &Exefs{in: in, offset: offset + int64(start), start: start}
+	if (header.Encrypted()) {
+		var err error
+		exefs.crypto, err = config.crypto(header)
+		if (err != nil) {
+			return nil, err
+		}
+	}
+
+	data := make([]byte, ExefsHeaderSize)
+	n, _ := in.ReadAt(data, exefs.offset)
+	if (n != len(data)) {
+		return nil, &errs.TruncatedError{What: "ExeFS header", Offset: exefs.offset, Size: ExefsHeaderSize, Read: int64(n)}
+	}
+	if (exefs.crypto != nil) {
+		exefs.decrypt(exefs.crypto.Primary, 0, data)
+	}
+
+	// Hashes are stored in reverse order, from the end of the header.
+	for i := 0; i < 10; i++ {
+		entry := data[i * 0x10:]
+		name := string(bytes.TrimRight(entry[0:8], "\x00"))
+		if (name == "") {
+			continue
+		}
+		file := ExefsFile{Name: name}
+		file.Offset = binary.LittleEndian.Uint32(entry[8:])
+		file.Size = binary.LittleEndian.Uint32(entry[12:])
+		copy(file.Hash[:], data[ExefsHeaderSize - (i + 1) * 0x20:])
+		exefs.Files = append(exefs.Files, file)
+	}
+	return exefs, nil
+}
+
+// File returns the entry with the given name, or nil.
+func (exefs *Exefs) File(name string) *ExefsFile {
+	for i := 0; i < len(exefs.Files); i++ {
+		if (exefs.Files[i].Name == name) {
+			return &exefs.Files[i]
+		}
+	}
+	return nil
+}
+
+// Offset returns the offset of file within the input.
+func (exefs *Exefs) Offset(file *ExefsFile) int64 {
+	return exefs.offset + ExefsHeaderSize + int64(file.Offset)
+}
+
+// Read returns the decrypted contents of file, checked against its hash.
+func (exefs *Exefs) Read(file *ExefsFile) ([]byte, error) {
+	position := ExefsHeaderSize + int64(file.Offset)
+	err := errs.CheckSize(exefs.in, "ExeFS file " + file.Name, exefs.Offset(file), int64(file.Size))
+	if (err != nil) {
+		return nil, err
+	}
+	data := make([]byte, file.Size)
+	n, _ := exefs.in.ReadAt(data, exefs.Offset(file))
+	if (n != len(data)) {
+		return nil, &errs.TruncatedError{What: "ExeFS file " + file.Name, Offset: exefs.Offset(file), Size: int64(file.Size), Read: int64(n)}
+	}
+
+	if (exefs.crypto != nil) {
+		key := exefs.crypto.Primary
+		if (file.Name != "icon" && file.Name != "banner") {
+			key, err = exefs.crypto.SecondaryKey()
+			if (err != nil) {
+				return nil, fmt.Errorf("Cannot decrypt ExeFS file %s: %v", file.Name, err)
+			}
+		}
+		exefs.decrypt(key, position, data)
+	}
+
+	hash := sha256.Sum256(data)
+	if (!bytes.Equal(hash[:], file.Hash[:])) {
+		return nil, &errs.HashMismatchError{What: "ExeFS file " + file.Name, Offset: exefs.Offset(file), Expected: file.Hash[:], Actual: hash[:]}
+	}
+	return data, nil
+}
+
+// Decrypts data found at position within the ExeFS, which must be a multiple of 0x10.
+func (exefs *Exefs) decrypt(key []byte, position int64, data []byte) {
+	crypto := exefs.crypto
+	if (crypto.header.Version == 1) {
+		AesCtr(key, crypto.Counter(SectionExefs, exefs.start + uint32(position)), data)
+		return
+	}
+	ctr := crypto.Counter(SectionExefs, exefs.start)
+	low := binary.BigEndian.Uint64(ctr[8:])
+	sum := low + uint64(position / 0x10)
+	if (sum < low) {
+		binary.BigEndian.PutUint64(ctr[0:], binary.BigEndian.Uint64(ctr[0:]) + 1)
+	}
+	binary.BigEndian.PutUint64(ctr[8:], sum)
+	AesCtr(key, ctr, data)
+}
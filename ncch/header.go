@@ -0,0 +1,102 @@
+package ncch
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"cxi2rsf/errs"
+)
+
+// Header is the 0x200-byte NCCH header. Offsets, sizes and hash region sizes
+// are in media units.
+type Header struct {
+	Signature [0x100]byte
+	Magic [4]byte
+	ContentSize uint32
+	PartitionId uint64
+	MakerCode [2]byte
+	Version uint16
+	SeedCheck uint32
+	ProgramId uint64
+	Reserved1 [0x10]byte
+	LogoRegionHash [0x20]byte
+	ProductCode [0x10]byte
+	ExheaderHash [0x20]byte
+	ExheaderSize uint32
+	Reserved2 [4]byte
+	Flags [8]byte
+	PlainRegionOffset uint32
+	PlainRegionSize uint32
+	LogoRegionOffset uint32
+	LogoRegionSize uint32
+	ExefsOffset uint32
+	ExefsSize uint32
+	ExefsHashRegionSize uint32
+	Reserved3 [4]byte
+	RomfsOffset uint32
+	RomfsSize uint32
+	RomfsHashRegionSize uint32
+	Reserved4 [4]byte
+	ExefsSuperblockHash [0x20]byte
+	RomfsSuperblockHash [0x20]byte
+}
+
+// Indices into Header.Flags.
+const (
+	FlagCryptoMethod = 3
+	FlagPlatform = 4
+	FlagContentType = 5
+	FlagContentUnitSize = 6
+	FlagOther = 7
+)
+
+// Bits of Header.Flags[FlagOther].
+const (
+	FixedCryptoKey = 1 << 0
+	NoMountRomfs = 1 << 1
+	NoCrypto = 1 << 2
+	UsesSeed = 1 << 5
+)
+
+// ParseHeader decodes the NCCH header at the start of data.
+func ParseHeader(data []byte) (*Header, error) {
+	if (len(data) < HeaderSize) {
+		return nil, &errs.TruncatedError{What: "NCCH header", Size: HeaderSize, Read: int64(len(data))}
+	}
+
+	header := &Header{}
+	err := binary.Read(bytes.NewReader(data[0:HeaderSize]), binary.LittleEndian, header)
+	if (err != nil) {
+		return nil, err
+	}
+	return header, nil
+}
+
+// Bytes encodes the header back into its 0x200-byte form.
+func (header *Header) Bytes() []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, header)
+	return buf.Bytes()
+}
+
+// HasExheader reports whether an exheader follows the header. CFAs have none.
+func (header *Header) HasExheader() bool {
+	return header.ExheaderSize != 0
+}
+
+func (header *Header) Encrypted() bool {
+	return (header.Flags[FlagOther] & NoCrypto) == 0
+}
+
+func (header *Header) FixedKey() bool {
+	return (header.Flags[FlagOther] & FixedCryptoKey) != 0
+}
+
+func (header *Header) UsesSeed() bool {
+	return (header.Flags[FlagOther] & UsesSeed) != 0
+}
+
+// ContentType is the form type stored in the upper bits of the content type flag.
+func (header *Header) ContentType() byte {
+	return header.Flags[FlagContentType] >> 2
+}
@@ -0,0 +1,118 @@
+package ncch
+
+import (
+	"bufio"
+	_ "embed"
+	"crypto/sha256"
+	hexenc "encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cxi2rsf/errs"
+)
+
+// LogoNames are the logos makerom builds in, by their RSF name.
+var LogoNames = []string{"Nintendo", "Licensed", "Distributed", "iQue", "iQueForSystem", "Homebrew"}
+
+// Logos maps the SHA-256 of a logo to its RSF name.
+type Logos map[[sha256.Size]byte]string
+
+//go:embed logos.txt
+var builtinLogos string
+
+// BuiltinLogos returns the hashes of the logos makerom builds in, from
+// logos.txt.
+func BuiltinLogos() Logos {
+	logos := Logos{}
+	err := logos.parse(strings.NewReader(builtinLogos), "logos.txt")
+	if (err != nil) {
+		panic(err)
+	}
+	return logos
+}
+
+// LoadLogos reads a logos file, one <name>=<hex SHA-256> per line, where name
+// is one of LogoNames, and adds it to the built-in logos.
+func LoadLogos(path string) (Logos, error) {
+	file, err := os.Open(path)
+	if (err != nil) {
+		return nil, err
+	}
+	defer file.Close()
+
+	logos := BuiltinLogos()
+	err = logos.parse(file, path)
+	if (err != nil) {
+		return nil, err
+	}
+	return logos, nil
+}
+
+// Adds the <name>=<hex SHA-256> lines of in, read from path, to logos.
+func (logos Logos) parse(in io.Reader, path string) error {
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if (text == "" || text[0] == '#') {
+			continue
+		}
+		eq := strings.IndexByte(text, '=')
+		if (eq < 0) {
+			return fmt.Errorf("%s:%d: expected <name>=<hash>", path, line)
+		}
+		name := ""
+		for i := 0; i < len(LogoNames); i++ {
+			if (strings.EqualFold(strings.TrimSpace(text[:eq]), LogoNames[i])) {
+				name = LogoNames[i]
+			}
+		}
+		if (name == "") {
+			return fmt.Errorf("%s:%d: unknown logo %q", path, line, strings.TrimSpace(text[:eq]))
+		}
+		hash, err := hexenc.DecodeString(strings.TrimSpace(text[eq + 1:]))
+		if (err != nil || len(hash) != sha256.Size) {
+			return fmt.Errorf("%s:%d: hash must be 32 hex-encoded bytes", path, line)
+		}
+		var sum [sha256.Size]byte
+		copy(sum[:], hash)
+		logos[sum] = name
+	}
+	return scanner.Err()
+}
+
+// Name returns the RSF name of logo, if it is known.
+func (logos Logos) Name(logo []byte) (string, bool) {
+	name, ok := logos[sha256.Sum256(logo)]
+	return name, ok
+}
+
+// ReadLogo returns the logo of the NCCH at offset: its logo region, or for
+// older NCCHs the ExeFS logo file. It returns nil if the NCCH has no logo.
+func ReadLogo(in io.ReaderAt, offset int64, header *Header, config *CryptoConfig) ([]byte, error) {
+	if (header.LogoRegionSize != 0) { // Never encrypted
+		logoOffset := offset + int64(header.LogoRegionOffset) * MediaUnit
+		size := int64(header.LogoRegionSize) * MediaUnit
+		err := errs.CheckSize(in, "logo region", logoOffset, size)
+		if (err != nil) {
+			return nil, err
+		}
+		logo := make([]byte, size)
+		n, _ := in.ReadAt(logo, logoOffset)
+		if (n != len(logo)) {
+			return nil, &errs.TruncatedError{What: "logo region", Offset: logoOffset, Size: int64(len(logo)), Read: int64(n)}
+		}
+		return logo, nil
+	}
+
+	exefs, err := OpenExefs(in, offset, header, config)
+	if (exefs == nil || err != nil) {
+		return nil, err
+	}
+	file := exefs.File("logo")
+	if (file == nil) {
+		return nil, nil
+	}
+	return exefs.Read(file)
+}
@@ -0,0 +1,53 @@
+package ncch
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The built-in table only names logos makerom builds in.
+func TestBuiltinLogos(t *testing.T) {
+	builtin := BuiltinLogos()
+	for hash, name := range builtin {
+		known := false
+		for i := 0; i < len(LogoNames); i++ {
+			known = known || (name == LogoNames[i])
+		}
+		if (!known) {
+			t.Errorf("logos.txt: %x has unknown name %s", hash, name)
+		}
+	}
+}
+
+// A logo added with a logos file resolves by name, on top of the built-in ones.
+func TestLoadLogos(t *testing.T) {
+	logo := make([]byte, 0x2000)
+	for i := 0; i < len(logo); i++ {
+		logo[i] = byte(i)
+	}
+	path := filepath.Join(t.TempDir(), "logos.txt")
+	text := fmt.Sprintf("# Comment\nhomebrew = %x\n", sha256.Sum256(logo))
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logos, err := LoadLogos(path)
+	if (err != nil) {
+		t.Fatal(err)
+	}
+	if name, ok := logos.Name(logo); !ok || name != "Homebrew" {
+		t.Errorf("Name(logo) = %q, %v, expected Homebrew", name, ok)
+	}
+	if name, ok := logos.Name(logo[1:]); ok {
+		t.Errorf("Name(other logo) = %q, expected no name", name)
+	}
+	builtin := BuiltinLogos()
+	for hash, name := range builtin {
+		if (logos[hash] != name) {
+			t.Errorf("Built-in %s missing after LoadLogos", name)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package ncch
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// NotCompressedError is returned by DecompressCode for data without a valid
+// footer, which is not compressed.
+type NotCompressedError struct {
+	Reason string
+}
+
+func (e *NotCompressedError) Error() string {
+	return e.Reason
+}
+
+// DecompressCode decompresses an ExeFS .code compressed with the backwards LZ
+// makerom uses. The data is decoded from the end: an 8-byte footer gives the
+// size of the compressed part at the end of the data, the size of the footer
+// and how much larger the decompressed code is. The data before the
+// compressed part is kept as is. Data without a valid footer gives a
+// NotCompressedError, and data that fails to decode any other error.
+func DecompressCode(data []byte) ([]byte, error) {
+	if (len(data) < 8) {
+		return nil, &NotCompressedError{Reason: fmt.Sprintf("Code is 0x%x bytes, smaller than a compression footer.", len(data))}
+	}
+	bounds := binary.LittleEndian.Uint32(data[len(data) - 8:])
+	extra := binary.LittleEndian.Uint32(data[len(data) - 4:])
+	footerSize := int(bounds >> 24)
+	compressedSize := int(bounds & 0xFFFFFF)
+	if (footerSize < 8 || footerSize > 0xB || compressedSize < footerSize || compressedSize > len(data) || extra == 0) {
+		return nil, &NotCompressedError{Reason: fmt.Sprintf("Invalid compressed code footer %08x %08x.", bounds, extra)}
+	}
+
+	out := make([]byte, len(data) + int(extra))
+	copy(out, data)
+	in := len(data) - footerSize // Both read and written downwards
+	dst := len(out)
+	stop := len(data) - compressedSize
+	for (in > stop) {
+		in--
+		control := data[in]
+		for i := 0; i < 8 && in > stop; i++ {
+			if ((control & 0x80) != 0) { // Copy 3-18 bytes from 3-4098 bytes above
+				if (in - 2 < stop) {
+					return nil, fmt.Errorf("Compressed code is truncated at 0x%x.", in)
+				}
+				in -= 2
+				segment := binary.LittleEndian.Uint16(data[in:])
+				size := int(segment >> 12) + 3
+				distance := int(segment & 0xFFF) + 3
+				if (dst - size < in || dst - 1 + distance >= len(out)) {
+					return nil, fmt.Errorf("Invalid back reference at 0x%x.", in)
+				}
+				for j := 0; j < size; j++ {
+					dst--
+					out[dst] = out[dst + distance]
+				}
+			} else {
+				if (dst - 1 < in) {
+					return nil, fmt.Errorf("Compressed code overlaps its output at 0x%x.", in)
+				}
+				in--
+				dst--
+				out[dst] = data[in]
+			}
+			control <<= 1
+		}
+	}
+	if (dst != stop) {
+		return nil, fmt.Errorf("Compressed code ends at 0x%x, expected 0x%x.", dst, stop)
+	}
+	return out, nil
+}
@@ -0,0 +1,41 @@
+package ncch
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// Returns data followed by a footer for a compressed part of compressedSize
+// bytes, including the 8-byte footer, that decompresses extra bytes larger.
+func withFooter(data []byte, compressedSize uint32, extra uint32) []byte {
+	footer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(footer, 8 << 24 | compressedSize)
+	binary.LittleEndian.PutUint32(footer[4:], extra)
+	return append(data, footer...)
+}
+
+// Data without a valid footer is not compressed; data with one that does not
+// decode is an error of its own.
+func TestDecompressCodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		notCompressed bool
+	}{
+		{"short", []byte{1, 2, 3}, true},
+		{"no footer", make([]byte, 0x20), true},
+		{"compressed part larger than the data", withFooter(make([]byte, 3), 0x100, 1), true},
+		{"back reference past the end", withFooter([]byte{0xFF, 0x0F, 0x80}, 11, 1), false},
+		{"output not filled", withFooter([]byte{0x00, 0x00, 0x00}, 11, 0x10), false},
+	}
+	for i := 0; i < len(tests); i++ {
+		_, err := DecompressCode(tests[i].data)
+		var notCompressed *NotCompressedError
+		if (err == nil) {
+			t.Errorf("%s: expected an error", tests[i].name)
+		} else if (errors.As(err, &notCompressed) != tests[i].notCompressed) {
+			t.Errorf("%s: got %T %v", tests[i].name, err, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package ncch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"cxi2rsf/errs"
+	"cxi2rsf/exheader"
+)
+
+const (
+	HeaderSize = 0x200
+	MediaUnit = 0x200
+)
+
+// Match reports whether header is the start of an NCCH.
+func Match(header []byte) bool {
+	return len(header) >= HeaderSize && string(header[0x100:0x104]) == "NCCH"
+}
+
+// Read reads the NCCH header and exheader at offset, decrypting the exheader
+// if the NCCH is encrypted. The exheader is nil for NCCHs without one, such as
+// CFAs.
+func Read(in io.ReaderAt, offset int64, config *CryptoConfig) (*Header, []byte, error) {
+	data := make([]byte, HeaderSize)
+	n, _ := in.ReadAt(data, offset)
+	if (n != len(data)) {
+		return nil, nil, &errs.TruncatedError{What: "NCCH header", Offset: offset, Size: HeaderSize, Read: int64(n)}
+	}
+	if (!Match(data)) {
+		return nil, nil, &errs.BadMagicError{What: "NCCH", Offset: offset + 0x100, Expected: "NCCH", Found: data[0x100:0x104]}
+	}
+
+	header, err := ParseHeader(data)
+	if (err != nil) {
+		return nil, nil, err
+	}
+	if (!header.HasExheader()) {
+		return header, nil, nil
+	}
+
+	exheaderData := make([]byte, exheader.Size)
+	n, _ = in.ReadAt(exheaderData, offset + HeaderSize)
+	if (n != len(exheaderData)) {
+		return nil, nil, &errs.TruncatedError{What: "exheader", Offset: offset + HeaderSize, Size: exheader.Size, Read: int64(n)}
+	}
+
+	if (header.Encrypted()) {
+		crypto, err := config.crypto(header)
+		if (err != nil) {
+			return nil, nil, err
+		}
+		crypto.DecryptExheader(exheaderData)
+	}
+
+	return header, exheaderData, nil
+}
+
+// Builds the keys for an encrypted NCCH from config, which may be nil.
+func (config *CryptoConfig) crypto(header *Header) (*Crypto, error) {
+	if (config == nil) {
+		config = &CryptoConfig{}
+	}
+	seed, err := Seed(header, config.Seeds, config.Seed)
+	if (err != nil) {
+		return nil, err
+	}
+	crypto, err := NewCrypto(header, config.Keys, seed)
+	if (err != nil && config.Keys == nil) {
+		return nil, fmt.Errorf("NCCH is encrypted, a keys file is required.")
+	}
+	return crypto, err
+}
+
+// CheckExheader checks the decrypted exheader against its SHA-256 in the
+// header. A mismatch means the exheader is corrupted, or still encrypted
+// although the header says otherwise.
+func CheckExheader(header *Header, exheaderData []byte) error {
+	hash := sha256.Sum256(exheaderData[:exheader.Size])
+	if (!bytes.Equal(hash[:], header.ExheaderHash[:])) {
+		return &errs.HashMismatchError{What: "exheader", Offset: HeaderSize, Expected: header.ExheaderHash[:], Actual: hash[:]}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package ncch
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// LoadSeedDb reads seeds from a seeddb.bin, keyed by program ID.
+// seeddb.bin is a 0x10-byte header holding the entry count, followed by
+// 0x20-byte entries of title ID, seed and padding.
+func LoadSeedDb(path string) (map[uint64][]byte, error) {
+	data, err := os.ReadFile(path)
+	if (err != nil) {
+		return nil, err
+	}
+	if (len(data) < 0x10) {
+		return nil, fmt.Errorf("%s: invalid seeddb", path)
+	}
+
+	count := int(binary.LittleEndian.Uint32(data[0:]))
+	if (len(data) < 0x10 + count * 0x20) {
+		return nil, fmt.Errorf("%s: seeddb truncated, expected %d entries", path, count)
+	}
+
+	seeds := map[uint64][]byte{}
+	for i := 0; i < count; i++ {
+		entry := data[0x10 + i * 0x20:]
+		seeds[binary.LittleEndian.Uint64(entry[0:])] = entry[8:0x18]
+	}
+	return seeds, nil
+}
+
+// CheckSeed reports whether seed matches the NCCH header's seed check.
+// The NCCH header stores the first 4 bytes of SHA256(seed || program ID) at 0x114.
+func CheckSeed(header *Header, seed []byte) bool {
+	programId := make([]byte, 8)
+	binary.LittleEndian.PutUint64(programId, header.ProgramId)
+	hash := sha256.Sum256(append(append([]byte{}, seed...), programId...))
+	return binary.LittleEndian.Uint32(hash[0:4]) == header.SeedCheck
+}
+
+// Seed picks the seed for an NCCH using seed crypto; override takes precedence over seeds.
+// Returns a nil seed if none is known, since only the secondary key depends on it.
+func Seed(header *Header, seeds map[uint64][]byte, override []byte) ([]byte, error) {
+	if (!header.UsesSeed()) {
+		return nil, nil
+	}
+
+	programId := header.ProgramId
+	seed := override
+	if (seed == nil) {
+		var ok bool
+		seed, ok = seeds[programId]
+		if (!ok) {
+			return nil, nil
+		}
+	}
+	if (!CheckSeed(header, seed)) {
+		return nil, fmt.Errorf("Seed for %016x does not match the NCCH seed check.", programId)
+	}
+	return seed, nil
+}
@@ -0,0 +1,62 @@
+package ncsd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"cxi2rsf/ncch"
+)
+
+type Partition struct {
+	Offset int64
+	Size int64
+}
+
+var partitionNames = []string {
+	"game",       // 0
+	"manual",     // 1
+	"dlp",        // 2
+	"",           // 3
+	"",           // 4
+	"",           // 5
+	"n3dsupdate", // 6
+	"update",     // 7
+}
+
+// Match reports whether header is the start of an NCSD image.
+func Match(header []byte) bool {
+	return len(header) >= 0x200 && string(header[0x100:0x104]) == "NCSD"
+}
+
+// Partitions returns the partition table; offsets and sizes are stored in media units.
+func Partitions(header []byte) (partitions [8]Partition) {
+	table := header[0x120:0x160]
+	for i := 0; i < 8; i++ {
+		partitions[i].Offset = int64(binary.LittleEndian.Uint32(table[i * 8:])) * ncch.MediaUnit
+		partitions[i].Size = int64(binary.LittleEndian.Uint32(table[i * 8 + 4:])) * ncch.MediaUnit
+	}
+	return
+}
+
+// PartitionIndex accepts either a partition index or a partition name.
+func PartitionIndex(name string) (int, error) {
+	for i := 0; i < len(partitionNames); i++ {
+		if (partitionNames[i] != "" && partitionNames[i] == name) {
+			return i, nil
+		}
+	}
+	index, err := strconv.Atoi(name)
+	if (err != nil || index < 0 || index > 7) {
+		return 0, fmt.Errorf("Invalid partition %q.", name)
+	}
+	return index, nil
+}
+
+// PartitionName returns the name of a partition, or its index if it has none.
+func PartitionName(index int) string {
+	if (partitionNames[index] != "") {
+		return partitionNames[index]
+	}
+	return strconv.Itoa(index)
+}
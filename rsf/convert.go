@@ -0,0 +1,441 @@
+package rsf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode"
+
+	"cxi2rsf/errs"
+	"cxi2rsf/exheader"
+	"cxi2rsf/ncch"
+)
+
+// Offsets within an NCCH of the fields New can reject.
+const (
+	headerProgramIdOffset = 0x118
+	programIdOffset = ncch.HeaderSize + 0x200
+	kernelCapsOffset = ncch.HeaderSize + exheader.KernelCapsOffset
+)
+
+var category = map[uint16]string {
+	0x0000: "Application",
+	0x0010: "SystemApplication",
+	0x0030: "Applet",
+	0x0138: "Firmware",
+	0x0130: "Base",
+	0x0001: "DlpChild",
+	0x0002: "Demo",
+	0x0003: "Contents",
+	0x001B: "SystemContents",
+	0x009B: "SharedContents",
+	0x008C: "AddOnContents",
+	0x000E: "Patch",
+	0x00DB: "AutoUpdateContents",
+}
+
+var new3dsSystemMode = map[byte]string {
+	0: "Legacy",
+	1: "124MB",
+	2: "178MB",
+	3: "124MB",
+}
+
+var old3dsSystemMode = map[byte]string {
+	0: "64MB",
+	2: "96MB",
+	3: "80MB",
+	4: "72MB",
+	5: "32MB",
+}
+
+var resourceLimitCategory = map[byte]string {
+	0: "application",
+	1: "sysapplet",
+	2: "libapplet",
+	3: "other",
+}
+
+var memoryType = map[byte]string {
+	1: "Application",
+	2: "System",
+	3: "Base",
+}
+
+// New builds the RSF describing an NCCH from its header and exheader. exh is
+// nil for NCCHs without an exheader, such as CFAs, whose RSF only has the
+// sections makerom reads for them. Errors carry offsets relative to the start
+// of the NCCH.
+func New(header *ncch.Header, exh *exheader.Exheader) (*Rsf, error) {
+	rsf := &Rsf{}
+	if (exh == nil) {
+		rsf.Cfa = true
+		err := parseProgramId(rsf, header.ProgramId, headerProgramIdOffset)
+		if (err != nil) {
+			return nil, err
+		}
+		// CFAs have no exheader to say whether they use a RomFS.
+		if (header.RomfsSize != 0) {
+			rsf.RomFs.RootPath = "assets/romfs"
+		}
+	} else {
+		err := parseExheader(rsf, exh)
+		if (err != nil) {
+			return nil, err
+		}
+	}
+	parseNcchHeader(rsf, header)
+	return rsf, nil
+}
+
+// Options control how Convert reads an NCCH. The zero value reads
+// unencrypted NCCHs and identifies the logo with the built-in logos.
+type Options struct {
+	Crypto *ncch.CryptoConfig // Keys and seeds for encrypted NCCHs
+	Force bool // Only warn when the exheader does not match its hash
+	Logos ncch.Logos // Logos identified by name, ncch.BuiltinLogos() when nil
+	SvcNames *SvcNames // Set as the SvcNames of the RSF
+	Warn func(message string) // Given problems that do not stop the conversion, may be nil
+}
+
+// Title is a converted NCCH.
+type Title struct {
+	Rsf *Rsf
+	Header *ncch.Header
+	Exheader *exheader.Exheader // nil for NCCHs without one, such as CFAs
+	Logo []byte // Set when the logo is not in Options.Logos, for makerom -logo
+}
+
+func (options *Options) warn(message string) {
+	if (options.Warn != nil) {
+		options.Warn(message)
+	}
+}
+
+// Convert reads the NCCH at offset, decrypting its exheader if needed, checks
+// the exheader against its hash and builds its RSF, with the logo identified
+// by options.Logos. A logo that cannot be read is only warned about. options
+// may be nil.
+func Convert(in io.ReaderAt, offset int64, options *Options) (*Title, error) {
+	if (options == nil) {
+		options = &Options{}
+	}
+	header, exheaderData, err := ncch.Read(in, offset, options.Crypto)
+	if (err != nil) {
+		return nil, err
+	}
+
+	t := &Title{Header: header}
+	if (exheaderData != nil) {
+		err = errs.Shift(ncch.CheckExheader(header, exheaderData), offset)
+		if (err != nil && !options.Force) {
+			return nil, err
+		}
+		if (err != nil) {
+			options.warn(err.Error())
+		}
+		t.Exheader, err = exheader.Parse(exheaderData)
+		if (err != nil) {
+			return nil, errs.Shift(err, offset + ncch.HeaderSize)
+		}
+		if (header.ExheaderSize != exheader.Size) {
+			options.warn(fmt.Sprintf("Exheader size at 0x%x is 0x%x, expected 0x%x.", offset + 0x180, header.ExheaderSize, exheader.Size))
+		}
+	}
+
+	t.Rsf, err = New(header, t.Exheader)
+	if (err != nil) {
+		return nil, errs.Shift(err, offset)
+	}
+	t.Rsf.SvcNames = options.SvcNames
+	logos := options.Logos
+	if (logos == nil) {
+		logos = ncch.BuiltinLogos()
+	}
+	logo, err := ncch.ReadLogo(in, offset, header, options.Crypto)
+	if (err != nil) {
+		options.warn("Cannot read the logo: " + err.Error())
+	} else if (!t.Rsf.SetLogo(logo, logos)) {
+		t.Logo = logo
+	}
+	return t, nil
+}
+
+func parseExheader(rsf *Rsf, exh *exheader.Exheader) error {
+	basicInfo := &rsf.BasicInfo
+	option := &rsf.Option
+	accessControlInfo := &rsf.AccessControlInfo
+	systemControlInfo := &rsf.SystemControlInfo
+
+	sci := &exh.SystemControlInfo
+	local := &exh.AccessControlInfo.Arm11LocalCaps
+	storage := &local.StorageInfo
+
+	basicInfo.Title = string(bytes.Trim(sci.Title[:], "\x00"))
+
+	option.EnableCompress = (sci.Flag & exheader.CompressExefsCode) != 0
+	option.UseOnSD = (sci.Flag & exheader.SdApplication) != 0
+
+	systemControlInfo.RemasterVersion = sci.RemasterVersion
+
+	systemControlInfo.StackSize = sci.StackSize
+
+	for i := 0; i < len(sci.Dependencies); i++ {
+		tid := sci.Dependencies[i]
+		if (tid == 0) {
+			break
+		}
+		systemControlInfo.Dependency = append(systemControlInfo.Dependency, tid)
+	}
+
+	systemControlInfo.SaveDataSize = sci.SaveDataSize
+	systemControlInfo.JumpId = sci.JumpId
+
+	err := parseProgramId(rsf, local.ProgramId, programIdOffset)
+	if (err != nil) {
+		return err
+	}
+
+
+
+	accessControlInfo.CoreVersion = uint16(local.CoreVersion)
+	
+	if ((local.Flag1 & 0b10) != 0) {
+		accessControlInfo.CpuSpeed = "804MHz"
+	} else {
+		accessControlInfo.CpuSpeed = "268MHz"
+	}
+
+	accessControlInfo.SystemModeExt = new3dsSystemMode[local.Flag2 & 0b1111]
+	
+	accessControlInfo.EnableL2Cache = (local.Flag1 & 1) != 0
+
+	accessControlInfo.AffinityMask = local.Flag0 >> 2 & 0b11
+	
+	accessControlInfo.IdealProcessor = local.Flag0 & 0b11
+
+	accessControlInfo.SystemMode = old3dsSystemMode[(local.Flag0 >> 4) & 0b1111]
+
+	accessControlInfo.Priority = local.Priority
+
+	accessControlInfo.MaxCpu = uint8(local.ResourceLimitDescriptors[0])
+
+	accessControlInfo.UseOtherVariationSaveData = ((storage.StorageAccessibleUniqueIds >> 60) & 0x1) != 0
+
+	if ((storage.OtherAttributes & exheader.NotUseRomfs) == 0) {
+		rsf.RomFs.RootPath = "assets/romfs"
+	}
+
+	if ((storage.OtherAttributes & exheader.UseExtendedSaveDataAccess) != 0) {
+		for i := 2; i >= 0; i-- {
+			id := (storage.StorageAccessibleUniqueIds >> (20 * i)) & 0xFFFFF
+			if (id == 0) {
+				break
+			}
+			accessControlInfo.AccessibleSaveDataIds = append(accessControlInfo.AccessibleSaveDataIds, uint32(id))
+		}
+		for i := 2; i >= 0; i-- {
+			id := (storage.ExtSaveDataId >> (20 * i)) & 0xFFFFF
+			if (id == 0) {
+				break
+			}
+			accessControlInfo.AccessibleSaveDataIds = append(accessControlInfo.AccessibleSaveDataIds, uint32(id))
+		}
+	} else {
+		if (storage.ExtSaveDataId != 0) {
+			accessControlInfo.UseExtSaveData = true
+			accessControlInfo.ExtSaveDataId = uint32(storage.ExtSaveDataId)
+		}
+		// Each ID keeps its slot, first ID in the highest bits, so that empty
+		// slots are encoded back in place.
+		accessControlInfo.OtherUserSaveDataId1 = uint32((storage.StorageAccessibleUniqueIds >> 40) & 0xFFFFF)
+		accessControlInfo.OtherUserSaveDataId2 = uint32((storage.StorageAccessibleUniqueIds >> 20) & 0xFFFFF)
+		accessControlInfo.OtherUserSaveDataId3 = uint32(storage.StorageAccessibleUniqueIds & 0xFFFFF)
+	}
+
+	accessControlInfo.SystemSaveDataId1 = storage.SystemSaveDataIds[0]
+	accessControlInfo.SystemSaveDataId2 = storage.SystemSaveDataIds[1]
+
+	accessControlInfo.FileSystemAccess = uint32(storage.FileSystemAccess())
+
+	for i := 0; i < len(local.ServiceAccessControl); i++ {
+		serviceName := string(bytes.Trim(local.ServiceAccessControl[i][:], "\x00"))
+		if (serviceName == "") {
+			break
+		}
+		accessControlInfo.ServiceAccessControl = append(accessControlInfo.ServiceAccessControl, serviceName)
+	}
+
+	accessControlInfo.ResourceLimitCategory = resourceLimitCategory[local.ResourceLimitCategory]
+	if (accessControlInfo.ResourceLimitCategory == "application") {
+		accessControlInfo.Priority -= 32
+		systemControlInfo.AppType = "application"
+	} else {
+		systemControlInfo.AppType = "system"
+	}
+
+	descriptors := exh.AccessControlInfo.Arm11KernelCaps.Descriptors
+	caps := exheader.DecodeKernelCaps(descriptors[:])
+	if (len(caps.Unpaired) > 0) {
+		i := caps.Unpaired[0]
+		return &errs.InvalidDescriptorError{Offset: kernelCapsOffset + int64(i) * 4, Descriptor: descriptors[i], Reason: "memory mapping start without an end"}
+	}
+	accessControlInfo.InterruptNumbers = caps.Interrupts
+	accessControlInfo.SystemCallAccess = caps.SystemCalls
+	accessControlInfo.ReleaseKernelMajor = caps.KernelMajor
+	accessControlInfo.ReleaseKernelMinor = caps.KernelMinor
+	accessControlInfo.HandleTableSize = caps.HandleTableSize
+
+	flags := caps.Flags
+	accessControlInfo.DisableDebug = !((flags & (1 << 0)) != 0)
+	accessControlInfo.EnableForceDebug = ((flags & (1 << 1)) != 0)
+	accessControlInfo.CanUseNonAlphabetAndNumber = ((flags & (1 << 2)) != 0)
+	accessControlInfo.CanWriteSharedPage = ((flags & (1 << 3)) != 0)
+	accessControlInfo.CanUsePrivilegedPriority = ((flags & (1 << 4)) != 0)
+	accessControlInfo.PermitMainFunctionArgument = ((flags & (1 << 5)) != 0)
+	accessControlInfo.CanShareDeviceMemory = ((flags & (1 << 6)) != 0)
+	accessControlInfo.RunnableOnSleep = ((flags & (1 << 7)) != 0)
+	accessControlInfo.MemoryType = memoryType[byte((flags >> 8) & 0b1111)]
+	accessControlInfo.SpecialMemoryArrange = ((flags & (1 << 12)) != 0)
+	accessControlInfo.CanAccessCore2 = ((flags & (1 << 13)) != 0)
+
+	for i := 0; i < len(caps.Mappings); i++ {
+		mapping := &caps.Mappings[i]
+		if (mapping.Static) {
+			accessControlInfo.MemoryMapping = append(accessControlInfo.MemoryMapping, mapping.String())
+		} else {
+			accessControlInfo.IORegisterMapping = append(accessControlInfo.IORegisterMapping, mapping.String())
+		}
+	}
+	accessControlInfo.OtherKernelCaps = caps.Other
+
+	arm9AccessControl := &exh.AccessControlInfo.Arm9AccessControl
+
+	arm9Descriptors := arm9AccessControl.DescriptorMask()
+
+	if ((arm9Descriptors & (1 << 0)) != 0) {
+		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "FsMountNand")
+	}
+	if ((arm9Descriptors & (1 << 1)) != 0) {
+		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "FsMountNandRoWrite")
+	}
+	if ((arm9Descriptors & (1 << 2)) != 0) {
+		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "FsMountTwln")
+	}
+	if ((arm9Descriptors & (1 << 3)) != 0) {
+		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "FsMountWnand")
+	}
+	if ((arm9Descriptors & (1 << 4)) != 0) {
+		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "FsMountCardSpi")
+	}
+	if ((arm9Descriptors & (1 << 5)) != 0) {
+		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "UseSdif3")
+	}
+	if ((arm9Descriptors & (1 << 6)) != 0) {
+		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "CreateSeed")
+	}
+	if ((arm9Descriptors & (1 << 7)) != 0) {
+		accessControlInfo.IoAccessControl = append(accessControlInfo.IoAccessControl, "UseCardSpi")
+	}
+	if ((arm9Descriptors & (1 << 8)) != 0) {
+		option.UseOnSD = true;
+	}
+
+	accessControlInfo.DescVersion = arm9AccessControl.DescVersion
+	return nil
+}
+
+// Sets the TitleInfo values taken from the program ID found at offset.
+func parseProgramId(rsf *Rsf, tid uint64, offset int64) error {
+	titleInfo := &rsf.TitleInfo
+	titleInfo.UniqueId = uint32((tid >> 8) & 0xFFFFFF)
+	name, ok := category[uint16(tid >> 32)]
+	if (!ok) {
+		return &errs.UnknownCategoryError{Offset: offset, Category: uint16(tid >> 32)}
+	}
+	titleInfo.Category = name
+	switch(titleInfo.Category) {
+		case "Demo":
+			titleInfo.DemoIndex = uint8(tid)
+		case "DlpChild":
+			titleInfo.ChildIndex = uint8(tid)
+		case "AddOnContents":
+			titleInfo.Variation = uint8(tid)
+		case "IsContents":
+			titleInfo.ContentsIndex = uint8(tid)
+	}
+	titleInfo.Version = uint8(tid)
+	return nil
+}
+
+func parseNcchHeader(rsf *Rsf, header *ncch.Header) {
+	basicInfo := &rsf.BasicInfo
+	titleInfo := &rsf.TitleInfo
+	option := &rsf.Option
+
+	option.EnableCrypt = header.Encrypted()
+
+	option.FreeProductCode = false
+	productCode := header.ProductCode[:]
+	basicInfo.ProductCode = string(bytes.Trim(productCode, "\x00"))
+	if (string(productCode[0:3]) != "CTR" && string(productCode[0:3]) != "KTR") {
+		option.FreeProductCode = true
+	} else {
+		for i := 3; i < 10; i++ {
+			if (i == 3 || i == 5) {
+				if (rune(productCode[i]) != '-') {
+					option.FreeProductCode = true
+					break
+				}
+			} else {
+				if (!unicode.IsDigit(rune(productCode[i])) && !unicode.IsLetter(rune(productCode[i]))) {
+					option.FreeProductCode = true
+					break
+				}
+			}
+		}
+	}
+
+	basicInfo.CompanyCode = string(header.MakerCode[:])
+
+	if (header.Flags[ncch.FlagPlatform] == 1) {
+		titleInfo.Platform = "CTR"
+	} else if (header.Flags[ncch.FlagPlatform] == 2) {
+		titleInfo.Platform = "snake"
+	}
+
+	switch(header.ContentType()) {
+		case 0:
+			basicInfo.ContentType = "Application"
+		case 1:
+			basicInfo.ContentType = "SystemUpdate"
+		case 2:
+			basicInfo.ContentType = "Manual"
+		case 3:
+			basicInfo.ContentType = "Child"
+		case 4:
+			basicInfo.ContentType = "Trial"
+		case 5:
+			basicInfo.ContentType = "ExtendedSystemUpdate"
+	}
+
+	basicInfo.Logo = "None" // Until SetLogo is given the logo
+}
+
+// SetLogo sets Logo to the name of logo in logos, or to None if logo is nil.
+// It reports false for a logo not in logos, which makerom can only rebuild
+// from a file given with -logo. Logo is then None, LogoUnknown is set, and
+// the file is recorded in LogoFile once extracted.
+func (rsf *Rsf) SetLogo(logo []byte, logos ncch.Logos) bool {
+	rsf.BasicInfo.Logo = "None"
+	rsf.LogoUnknown = false
+	if (logo == nil) {
+		return true
+	}
+	name, ok := logos.Name(logo)
+	if (ok) {
+		rsf.BasicInfo.Logo = name
+	}
+	rsf.LogoUnknown = !ok
+	return ok
+}
@@ -0,0 +1,35 @@
+package rsf
+
+import (
+	"testing"
+
+	"cxi2rsf/exheader"
+	"cxi2rsf/ncch"
+)
+
+// Flag1 holds the L2 cache and CPU speed bits, Flag2 the New 3DS system mode.
+func TestNewSystemModeExt(t *testing.T) {
+	tests := []struct {
+		flag1, flag2 byte
+		cpuSpeed, systemModeExt string
+	}{
+		{0b10, 0, "804MHz", "Legacy"},
+		{0b11, 1, "804MHz", "124MB"},
+		{0, 2, "268MHz", "178MB"},
+	}
+	for i := 0; i < len(tests); i++ {
+		exh := &exheader.Exheader{}
+		local := &exh.AccessControlInfo.Arm11LocalCaps
+		local.ProgramId = 0x0004000000123400
+		local.Flag1 = tests[i].flag1
+		local.Flag2 = tests[i].flag2
+		rsf, err := New(&ncch.Header{ProgramId: local.ProgramId}, exh)
+		if (err != nil) {
+			t.Fatal(err)
+		}
+		info := &rsf.AccessControlInfo
+		if (info.CpuSpeed != tests[i].cpuSpeed || info.SystemModeExt != tests[i].systemModeExt) {
+			t.Errorf("Flag1 %#x, Flag2 %#x: got %s and %s, expected %s and %s", tests[i].flag1, tests[i].flag2, info.CpuSpeed, info.SystemModeExt, tests[i].cpuSpeed, tests[i].systemModeExt)
+		}
+	}
+}
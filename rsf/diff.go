@@ -0,0 +1,131 @@
+package rsf
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Change is one difference between two RSFs. For list keys each added or
+// removed item is its own Change, with Old or New left empty.
+type Change struct {
+	Section string
+	Key string
+	Old string
+	New string
+}
+
+// Keys printed in decimal; other numbers are IDs, sizes or masks printed in hex.
+var decimalKeys = map[string]bool {
+	"Priority": true,
+	"CoreVersion": true,
+	"DescVersion": true,
+	"IdealProcessor": true,
+	"AffinityMask": true,
+	"ReleaseKernelMajor": true,
+	"ReleaseKernelMinor": true,
+	"RemasterVersion": true,
+	"Version": true,
+}
+
+// Diff compares every section of a and b. List keys such as services, SVCs,
+// FS access flags, mappings and dependencies are compared as sets. SVCs are
+// named with the SvcNames of a, or of b if a has none.
+func Diff(a *Rsf, b *Rsf) []Change {
+	changes := []Change{}
+	names := a.SvcNames
+	if (names == nil) {
+		names = b.SvcNames
+	}
+	va := reflect.ValueOf(a).Elem()
+	vb := reflect.ValueOf(b).Elem()
+	for i := 0; i < va.NumField(); i++ {
+		section := va.Type().Field(i).Name
+		sa := va.Field(i)
+		sb := vb.Field(i)
+		if (sa.Kind() != reflect.Struct) {
+			continue
+		}
+		for j := 0; j < sa.NumField(); j++ {
+			key := sa.Type().Field(j).Name
+			fa := sa.Field(j)
+			fb := sb.Field(j)
+			if (key == "FileSystemAccess") {
+				changes = diffItems(changes, section, key, fileSystemAccessNames(uint32(fa.Uint())), fileSystemAccessNames(uint32(fb.Uint())))
+			} else if (fa.Kind() == reflect.Slice) {
+				changes = diffItems(changes, section, key, formatItems(key, fa, names), formatItems(key, fb, names))
+			} else if (!reflect.DeepEqual(fa.Interface(), fb.Interface())) {
+				changes = append(changes, Change{section, key, formatValue(key, fa, names), formatValue(key, fb, names)})
+			}
+		}
+	}
+	return changes
+}
+
+func diffItems(changes []Change, section string, key string, a []string, b []string) []Change {
+	inA := map[string]bool{}
+	inB := map[string]bool{}
+	for i := 0; i < len(a); i++ {
+		inA[a[i]] = true
+	}
+	for i := 0; i < len(b); i++ {
+		inB[b[i]] = true
+	}
+	for i := 0; i < len(a); i++ {
+		if (!inB[a[i]]) {
+			changes = append(changes, Change{section, key, a[i], ""})
+		}
+	}
+	for i := 0; i < len(b); i++ {
+		if (!inA[b[i]]) {
+			changes = append(changes, Change{section, key, "", b[i]})
+		}
+	}
+	return changes
+}
+
+func fileSystemAccessNames(mask uint32) (names []string) {
+	for i := 0; i < 32; i++ {
+		if ((mask & (1 << i)) == 0) {
+			continue
+		}
+		name, ok := filesystemAccessInfo[byte(i)]
+		if (!ok) {
+			name = fmt.Sprintf("bit %d", i)
+		}
+		names = append(names, name)
+	}
+	return
+}
+
+func formatItems(key string, list reflect.Value, names *SvcNames) (items []string) {
+	for i := 0; i < list.Len(); i++ {
+		items = append(items, formatValue(key, list.Index(i), names))
+	}
+	return
+}
+
+func formatValue(key string, value reflect.Value, names *SvcNames) string {
+	switch (value.Kind()) {
+		case reflect.String:
+			return quotes(value.String())
+		case reflect.Bool:
+			return truth(value.Bool())
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n := value.Uint()
+			switch {
+				case key == "SystemCallAccess":
+					return fmt.Sprintf("%s (0x%02x)", names.Name(uint32(n)), n)
+				case key == "Dependency":
+					if name, ok := dependencies[n]; ok {
+						return fmt.Sprintf("%s (%s)", name, hexFill(n, 16))
+					}
+					return hexFill(n, 16)
+				case key == "SaveDataSize":
+					return size(n)
+				case decimalKeys[key]:
+					return dec(n)
+			}
+			return hex(n)
+	}
+	return fmt.Sprint(value.Interface())
+}
@@ -0,0 +1,54 @@
+package rsf
+
+import (
+	"bytes"
+	"testing"
+
+	"cxi2rsf/exheader"
+	"cxi2rsf/ncch"
+)
+
+// Returns the RSF of an application whose ContentType, Platform,
+// ResourceLimitCategory, AppType and JumpId are makerom's defaults.
+func defaultTitle(t *testing.T) *Rsf {
+	exh := &exheader.Exheader{}
+	local := &exh.AccessControlInfo.Arm11LocalCaps
+	local.ProgramId = 0x0004000000123400
+	exh.SystemControlInfo.JumpId = local.ProgramId
+	descriptors := &exh.AccessControlInfo.Arm11KernelCaps.Descriptors
+	for i := 0; i < len(descriptors); i++ {
+		descriptors[i] = 0xFFFFFFFF // Unused
+	}
+	header := &ncch.Header{ProgramId: local.ProgramId}
+	copy(header.MakerCode[:], "00")
+	copy(header.ProductCode[:], "CTR-P-ABCD")
+	header.Flags[ncch.FlagPlatform] = 1
+	rsf, err := New(header, exh)
+	if (err != nil) {
+		t.Fatal(err)
+	}
+	return rsf
+}
+
+// The homebrew template comments out keys equal to their default, which must
+// read back as the default.
+func TestDiffHomebrewTemplate(t *testing.T) {
+	rsf := defaultTitle(t)
+	tmpl, err := LoadTemplate("homebrew")
+	if (err != nil) {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	err = WriteTemplate(out, rsf, tmpl)
+	if (err != nil) {
+		t.Fatal(err)
+	}
+	read, err := Read(out)
+	if (err != nil) {
+		t.Fatal(err)
+	}
+	changes := Diff(rsf, read)
+	for i := 0; i < len(changes); i++ {
+		t.Errorf("%s/%s: %q -> %q", changes[i].Section, changes[i].Key, changes[i].Old, changes[i].New)
+	}
+}
@@ -0,0 +1,320 @@
+package rsf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"cxi2rsf/exheader"
+)
+
+// Title ID platform, shared by CTR and snake titles.
+const platformCtr = 0x0004
+
+var arm9IoAccessControl = []string {
+	"FsMountNand",        // 0
+	"FsMountNandRoWrite", // 1
+	"FsMountTwln",        // 2
+	"FsMountWnand",       // 3
+	"FsMountCardSpi",     // 4
+	"UseSdif3",           // 5
+	"CreateSeed",         // 6
+	"UseCardSpi",         // 7
+}
+
+// Finds the lowest key of a lookup table such as category that maps to name,
+// ignoring case as makerom does.
+func reverseLookup(table interface{}, name string) (uint64, bool) {
+	var key uint64
+	found := false
+	iter := reflect.ValueOf(table).MapRange()
+	for iter.Next() {
+		if (strings.EqualFold(iter.Value().String(), name) && (!found || iter.Key().Uint() < key)) {
+			key = iter.Key().Uint()
+			found = true
+		}
+	}
+	return key, found
+}
+
+// ProgramId rebuilds the program ID from TitleInfo.
+func (rsf *Rsf) ProgramId() (uint64, error) {
+	titleInfo := &rsf.TitleInfo
+	categoryId, ok := reverseLookup(category, titleInfo.Category)
+	if (!ok) {
+		return 0, fmt.Errorf("Unknown category %q.", titleInfo.Category)
+	}
+
+	low := uint64(titleInfo.Version)
+	if (titleInfo.ContentsIndex != 0) {
+		low = uint64(titleInfo.ContentsIndex)
+	} else if (titleInfo.Variation != 0) {
+		low = uint64(titleInfo.Variation)
+	} else if (titleInfo.ChildIndex != 0) {
+		low = uint64(titleInfo.ChildIndex)
+	} else if (titleInfo.DemoIndex != 0) {
+		low = uint64(titleInfo.DemoIndex)
+	}
+	return platformCtr << 48 | categoryId << 32 | uint64(titleInfo.UniqueId & 0xFFFFFF) << 8 | low, nil
+}
+
+// Exheader builds the SCI and ACI that makerom would produce from the RSF.
+// Values that makerom takes from the ELF, such as the code set layout, are
+// left zero.
+func (rsf *Rsf) Exheader() (*exheader.Exheader, error) {
+	if (rsf.Cfa) {
+		return nil, fmt.Errorf("A CFA has no exheader.")
+	}
+	exh := &exheader.Exheader{}
+	option := &rsf.Option
+	accessControlInfo := &rsf.AccessControlInfo
+	systemControlInfo := &rsf.SystemControlInfo
+
+	sci := &exh.SystemControlInfo
+	copy(sci.Title[:], rsf.BasicInfo.Title)
+	if (option.EnableCompress) {
+		sci.Flag |= exheader.CompressExefsCode
+	}
+	if (option.UseOnSD) {
+		sci.Flag |= exheader.SdApplication
+	}
+	sci.RemasterVersion = systemControlInfo.RemasterVersion
+	sci.StackSize = systemControlInfo.StackSize
+	if (len(systemControlInfo.Dependency) > len(sci.Dependencies)) {
+		return nil, fmt.Errorf("Too many dependencies: %d.", len(systemControlInfo.Dependency))
+	}
+	copy(sci.Dependencies[:], systemControlInfo.Dependency)
+	sci.SaveDataSize = systemControlInfo.SaveDataSize
+
+	local := &exh.AccessControlInfo.Arm11LocalCaps
+	storage := &local.StorageInfo
+
+	programId, err := rsf.ProgramId()
+	if (err != nil) {
+		return nil, err
+	}
+	sci.JumpId = systemControlInfo.JumpId
+	if (sci.JumpId == 0) { // makerom defaults to the title itself
+		sci.JumpId = programId
+	}
+	local.ProgramId = programId
+	local.CoreVersion = uint32(accessControlInfo.CoreVersion)
+
+	if (accessControlInfo.EnableL2Cache) {
+		local.Flag1 |= 1
+	}
+	if (accessControlInfo.CpuSpeed == "804MHz") {
+		local.Flag1 |= 0b10
+	}
+	if (accessControlInfo.SystemModeExt != "") {
+		mode, ok := reverseLookup(new3dsSystemMode, accessControlInfo.SystemModeExt)
+		if (!ok) {
+			return nil, fmt.Errorf("Unknown SystemModeExt %q.", accessControlInfo.SystemModeExt)
+		}
+		local.Flag2 = byte(mode)
+	}
+	mode, ok := reverseLookup(old3dsSystemMode, accessControlInfo.SystemMode)
+	if (!ok && accessControlInfo.SystemMode != "") {
+		return nil, fmt.Errorf("Unknown SystemMode %q.", accessControlInfo.SystemMode)
+	}
+	local.Flag0 = accessControlInfo.IdealProcessor & 0b11 | (accessControlInfo.AffinityMask & 0b11) << 2 | byte(mode) << 4
+
+	resourceLimit, ok := reverseLookup(resourceLimitCategory, accessControlInfo.ResourceLimitCategory)
+	if (!ok && accessControlInfo.ResourceLimitCategory != "") { // makerom defaults to application
+		return nil, fmt.Errorf("Unknown ResourceLimitCategory %q.", accessControlInfo.ResourceLimitCategory)
+	}
+	local.ResourceLimitCategory = byte(resourceLimit)
+	local.Priority = accessControlInfo.Priority
+	if (resourceLimitCategory[local.ResourceLimitCategory] == "application") {
+		local.Priority += 32
+	}
+	local.ResourceLimitDescriptors[0] = uint16(accessControlInfo.MaxCpu)
+
+	err = encodeStorageInfo(storage, rsf)
+	if (err != nil) {
+		return nil, err
+	}
+
+	if (len(accessControlInfo.ServiceAccessControl) > len(local.ServiceAccessControl)) {
+		return nil, fmt.Errorf("Too many services: %d.", len(accessControlInfo.ServiceAccessControl))
+	}
+	for i := 0; i < len(accessControlInfo.ServiceAccessControl); i++ {
+		copy(local.ServiceAccessControl[i][:], accessControlInfo.ServiceAccessControl[i])
+	}
+
+	descriptors, err := encodeKernelCaps(rsf)
+	if (err != nil) {
+		return nil, err
+	}
+	copy(exh.AccessControlInfo.Arm11KernelCaps.Descriptors[:], descriptors)
+
+	arm9 := &exh.AccessControlInfo.Arm9AccessControl
+	var arm9Descriptors uint32
+	for i := 0; i < len(accessControlInfo.IoAccessControl); i++ {
+		found := false
+		for bit := 0; bit < len(arm9IoAccessControl); bit++ {
+			if (arm9IoAccessControl[bit] == accessControlInfo.IoAccessControl[i]) {
+				arm9Descriptors |= 1 << bit
+				found = true
+			}
+		}
+		if (!found) {
+			return nil, fmt.Errorf("Unknown IoAccessControl %q.", accessControlInfo.IoAccessControl[i])
+		}
+	}
+	if (option.UseOnSD) {
+		arm9Descriptors |= 1 << 8
+	}
+	binary.LittleEndian.PutUint32(arm9.Descriptors[0:], arm9Descriptors)
+	arm9.DescVersion = accessControlInfo.DescVersion
+
+	return exh, nil
+}
+
+// Packs up to three 20-bit save data IDs, first ID in the highest bits.
+func packSaveDataIds(ids []uint32) (packed uint64) {
+	for i := 0; i < len(ids); i++ {
+		packed |= uint64(ids[i] & 0xFFFFF) << (20 * (2 - i))
+	}
+	return
+}
+
+func encodeStorageInfo(storage *exheader.StorageInfo, rsf *Rsf) error {
+	accessControlInfo := &rsf.AccessControlInfo
+
+	if (rsf.RomFs.RootPath == "") {
+		storage.OtherAttributes |= exheader.NotUseRomfs
+	}
+
+	if (len(accessControlInfo.AccessibleSaveDataIds) > 0) {
+		ids := accessControlInfo.AccessibleSaveDataIds
+		if (len(ids) > 6) {
+			return fmt.Errorf("Too many AccessibleSaveDataIds: %d.", len(ids))
+		}
+		storage.OtherAttributes |= exheader.UseExtendedSaveDataAccess
+		if (len(ids) > 3) {
+			storage.ExtSaveDataId = packSaveDataIds(ids[3:])
+			ids = ids[:3]
+		}
+		storage.StorageAccessibleUniqueIds = packSaveDataIds(ids)
+	} else {
+		if (accessControlInfo.UseExtSaveData) {
+			storage.ExtSaveDataId = uint64(accessControlInfo.ExtSaveDataId)
+		}
+		ids := []uint32{accessControlInfo.OtherUserSaveDataId1, accessControlInfo.OtherUserSaveDataId2, accessControlInfo.OtherUserSaveDataId3}
+		storage.StorageAccessibleUniqueIds = packSaveDataIds(ids) // Empty slots are kept
+	}
+	if (accessControlInfo.UseOtherVariationSaveData) {
+		storage.StorageAccessibleUniqueIds |= 1 << 60
+	}
+
+	storage.SystemSaveDataIds[0] = accessControlInfo.SystemSaveDataId1
+	storage.SystemSaveDataIds[1] = accessControlInfo.SystemSaveDataId2
+
+	var fsAccess [8]byte
+	binary.LittleEndian.PutUint64(fsAccess[:], uint64(accessControlInfo.FileSystemAccess))
+	copy(storage.FileSystemAccessInfo[:], fsAccess[:7])
+	return nil
+}
+
+func boolBit(value bool, bit uint) uint32 {
+	if (value) {
+		return 1 << bit
+	}
+	return 0
+}
+
+// Parses "start-end" mappings as written by Write, or "start" for a single
+// page, with an optional ":r" suffix.
+func parseMapping(mapping string) (start uint32, end uint32, page bool, readOnly bool, err error) {
+	readOnly = strings.HasSuffix(mapping, ":r")
+	mapping = strings.TrimSuffix(mapping, ":r")
+	dash := strings.IndexByte(mapping, '-')
+	if (dash < 0) {
+		start64, err1 := strconv.ParseUint(strings.TrimPrefix(mapping, "0x"), 16, 32)
+		if (err1 != nil) {
+			err = fmt.Errorf("Invalid mapping %q.", mapping)
+			return
+		}
+		return uint32(start64), uint32(start64) | 0xFFF, true, readOnly, nil
+	}
+	start64, err1 := strconv.ParseUint(strings.TrimPrefix(mapping[:dash], "0x"), 16, 32)
+	end64, err2 := strconv.ParseUint(strings.TrimPrefix(mapping[dash + 1:], "0x"), 16, 32)
+	if (err1 != nil || err2 != nil) {
+		err = fmt.Errorf("Invalid mapping %q.", mapping)
+		return
+	}
+	return uint32(start64), uint32(end64), false, readOnly, nil
+}
+
+// Packs the kernel capabilities in makerom's order, padding with unused descriptors.
+func encodeKernelCaps(rsf *Rsf) ([]uint32, error) {
+	accessControlInfo := &rsf.AccessControlInfo
+	descriptors := []uint32{}
+
+	interrupts := accessControlInfo.InterruptNumbers
+	for i := 0; i < len(interrupts); i += 4 {
+		descriptor := uint32(0xE0000000)
+		for j := 0; j < 4 && i + j < len(interrupts); j++ {
+			descriptor |= uint32(interrupts[i + j] & 0b1111111) << (7 * (3 - j))
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+
+	var svcMasks [8]uint32
+	for i := 0; i < len(accessControlInfo.SystemCallAccess); i++ {
+		id := accessControlInfo.SystemCallAccess[i]
+		if (id >= 24 * 8) {
+			return nil, fmt.Errorf("Invalid system call %d.", id)
+		}
+		svcMasks[id / 24] |= 1 << (id % 24)
+	}
+	for i := 0; i < len(svcMasks); i++ {
+		if (svcMasks[i] != 0) {
+			descriptors = append(descriptors, 0xF0000000 | uint32(i) << 24 | svcMasks[i])
+		}
+	}
+
+	descriptors = append(descriptors, 0xFC000000 | uint32(accessControlInfo.ReleaseKernelMajor) << 8 | uint32(accessControlInfo.ReleaseKernelMinor))
+	descriptors = append(descriptors, 0xFE000000 | accessControlInfo.HandleTableSize & 0x7FFFF)
+
+	memoryTypeId, _ := reverseLookup(memoryType, accessControlInfo.MemoryType)
+	descriptors = append(descriptors, 0xFF000000 |
+		boolBit(!accessControlInfo.DisableDebug, 0) |
+		boolBit(accessControlInfo.EnableForceDebug, 1) |
+		boolBit(accessControlInfo.CanUseNonAlphabetAndNumber, 2) |
+		boolBit(accessControlInfo.CanWriteSharedPage, 3) |
+		boolBit(accessControlInfo.CanUsePrivilegedPriority, 4) |
+		boolBit(accessControlInfo.PermitMainFunctionArgument, 5) |
+		boolBit(accessControlInfo.CanShareDeviceMemory, 6) |
+		boolBit(accessControlInfo.RunnableOnSleep, 7) |
+		uint32(memoryTypeId & 0b1111) << 8 |
+		boolBit(accessControlInfo.SpecialMemoryArrange, 12) |
+		boolBit(accessControlInfo.CanAccessCore2, 13))
+
+	mappings := [][]string{accessControlInfo.MemoryMapping, accessControlInfo.IORegisterMapping}
+	for static := 0; static < len(mappings); static++ {
+		for i := 0; i < len(mappings[static]); i++ {
+			start, end, page, readOnly, err := parseMapping(mappings[static][i])
+			if (err != nil) {
+				return nil, err
+			}
+			if (page && static == 1 && !readOnly) { // Single IO page
+				descriptors = append(descriptors, 0xFFE00000 | start >> 12)
+				continue
+			}
+			descriptors = append(descriptors, 0xFF800000 | start >> 12 | boolBit(readOnly, 20))
+			descriptors = append(descriptors, 0xFF800000 | (end + 1) >> 12 | boolBit(static == 0, 20))
+		}
+	}
+
+	if (len(descriptors) > 28) {
+		return nil, fmt.Errorf("Too many kernel capability descriptors: %d.", len(descriptors))
+	}
+	for len(descriptors) < 28 {
+		descriptors = append(descriptors, exheader.UnusedDescriptor)
+	}
+	return descriptors, nil
+}
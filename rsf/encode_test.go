@@ -0,0 +1,37 @@
+package rsf
+
+import (
+	"testing"
+
+	"cxi2rsf/exheader"
+	"cxi2rsf/ncch"
+)
+
+// Converting an exheader and encoding the RSF back keeps the slot of each
+// other user save data ID, including empty slots.
+func TestOtherUserSaveDataIdsRoundTrip(t *testing.T) {
+	tests := []uint64{
+		0x1000000000012345, // Lone ID in the low slot, with UseOtherVariationSaveData
+		0x0000000123400000,
+		0x0012340000056789,
+		0x0FFFFFFFFFFFFFFF,
+	}
+	for i := 0; i < len(tests); i++ {
+		exh := &exheader.Exheader{}
+		local := &exh.AccessControlInfo.Arm11LocalCaps
+		local.ProgramId = 0x0004000000123400
+		local.StorageInfo.StorageAccessibleUniqueIds = tests[i]
+		rsf, err := New(&ncch.Header{ProgramId: local.ProgramId}, exh)
+		if (err != nil) {
+			t.Fatal(err)
+		}
+		encoded, err := rsf.Exheader()
+		if (err != nil) {
+			t.Fatal(err)
+		}
+		ids := encoded.AccessControlInfo.Arm11LocalCaps.StorageInfo.StorageAccessibleUniqueIds
+		if (ids != tests[i]) {
+			t.Errorf("StorageAccessibleUniqueIds %#016x encoded back as %#016x", tests[i], ids)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package rsf
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+
+	"cxi2rsf/exheader"
+	"cxi2rsf/ncch"
+)
+
+// Byte arrays holding text rather than binary data.
+var textKeys = map[string]bool {
+	"Magic": true,
+	"MakerCode": true,
+	"ProductCode": true,
+	"Title": true,
+	"ServiceAccessControl": true,
+}
+
+// WriteJson writes the RSF together with the raw NCCH header and exheader
+// fields as JSON. Keys are the Go field names, which match the RSF keys; IDs,
+// masks and sizes are zero-padded hex strings and hashes are hex-encoded. Reserved fields
+// are left out.
+func WriteJson(w io.Writer, rsf *Rsf, header *ncch.Header, exh *exheader.Exheader) error {
+	model := map[string]interface{} {
+		"Rsf": jsonValue("", reflect.ValueOf(rsf).Elem()),
+	}
+	if (header != nil) {
+		model["Ncch"] = jsonValue("", reflect.ValueOf(header).Elem())
+	}
+	if (exh != nil) {
+		model["Exheader"] = jsonValue("", reflect.ValueOf(exh).Elem())
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(model)
+}
+
+func jsonValue(key string, value reflect.Value) interface{} {
+	switch (value.Kind()) {
+		case reflect.Struct:
+			fields := map[string]interface{}{}
+			for i := 0; i < value.NumField(); i++ {
+				name := value.Type().Field(i).Name
+				if (strings.HasPrefix(name, "Reserved") || name == "SvcNames") {
+					continue
+				}
+				fields[name] = jsonValue(name, value.Field(i))
+			}
+			return fields
+		case reflect.Array, reflect.Slice:
+			if (value.Type().Elem().Kind() == reflect.Uint8 && value.Kind() == reflect.Array) {
+				data := make([]byte, value.Len())
+				reflect.Copy(reflect.ValueOf(data), value)
+				if (textKeys[key]) {
+					return string(bytes.TrimRight(data, "\x00"))
+				}
+				return strings.TrimPrefix(hex(data), "0x")
+			}
+			if (key == "ServiceAccessControl" && value.Kind() == reflect.Array) { // Drop unused entries
+				items := []interface{}{}
+				for i := 0; i < value.Len(); i++ {
+					if item := jsonValue(key, value.Index(i)); item != "" {
+						items = append(items, item)
+					}
+				}
+				return items
+			}
+			items := make([]interface{}, value.Len())
+			for i := 0; i < value.Len(); i++ {
+				items[i] = jsonValue(key, value.Index(i))
+			}
+			return items
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if (decimalKeys[key]) {
+				return value.Uint()
+			}
+			return hexFill(value.Uint(), int(value.Type().Size()) * 2)
+	}
+	return value.Interface()
+}
@@ -0,0 +1,106 @@
+package rsf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Keys makerom reads that have no Rsf field, by section. Sections with no Rsf
+// field are listed even when they have no keys, such as PlainRegion, a list.
+var makeromOnlyKeys = map[string][]string {
+	"BasicInfo": {"BackupMemoryType"},
+	"RomFs": {"DefaultReject", "Reject", "Include", "File"},
+	"TitleInfo": {"TargetCategory", "CategoryFlags"},
+	"Option": {"AllowUnalignedSection", "MediaFootPadding"},
+	"AccessControlInfo": {},
+	"SystemControlInfo": {},
+	"CardInfo": {"WritableAddress", "CardType", "CryptoType", "CardDevice", "MediaType", "MediaSize", "BackupWriteWaitTime", "SaveCrypto"},
+	"ExeFs": {"Text", "ReadOnly", "ReadWrite"},
+	"PlainRegion": {},
+	"CommonHeaderKey": {"D", "P", "Q", "DP", "DQ", "InverseQ", "Modulus", "Exponent", "AccCtlDescSign", "AccCtlDescBin"},
+}
+
+// LintKeys returns a problem for each key makerom does not read, out of the
+// unknown keys recorded by Reader. Keys of an unknown section are covered by
+// the problem for the section.
+func LintKeys(unknown []string) (problems []string) {
+	for i := 0; i < len(unknown); i++ {
+		sectionName := unknown[i]
+		name := ""
+		if slash := strings.IndexByte(sectionName, '/'); slash >= 0 {
+			sectionName, name = sectionName[:slash], sectionName[slash + 1:]
+		}
+		keys, ok := makeromOnlyKeys[sectionName]
+		if (!ok) {
+			if (name == "") {
+				problems = append(problems, fmt.Sprintf("Unknown section %s.", sectionName))
+			}
+			continue
+		}
+		known := (name == "")
+		for j := 0; j < len(keys); j++ {
+			if (keys[j] == name) {
+				known = true
+			}
+		}
+		if (!known) {
+			problems = append(problems, fmt.Sprintf("Unknown key %s.", unknown[i]))
+		}
+	}
+	return
+}
+
+// Lint returns the problems in rsf that makerom would reject or silently work
+// around, such as values truncated to fit the exheader.
+func Lint(rsf *Rsf) (problems []string) {
+	basicInfo := &rsf.BasicInfo
+	accessControlInfo := &rsf.AccessControlInfo
+
+	if (len(basicInfo.Title) > 8) {
+		problems = append(problems, fmt.Sprintf("Title %q is longer than 8 bytes and is truncated in the exheader.", basicInfo.Title))
+	}
+	if (len(basicInfo.ProductCode) > 16) {
+		problems = append(problems, fmt.Sprintf("ProductCode %q is longer than 16 characters.", basicInfo.ProductCode))
+	}
+	if (basicInfo.CompanyCode != "" && len(basicInfo.CompanyCode) != 2) {
+		problems = append(problems, fmt.Sprintf("CompanyCode %q is not 2 characters.", basicInfo.CompanyCode))
+	}
+
+	services := accessControlInfo.ServiceAccessControl
+	if (len(services) > 32 && len(services) <= 34) {
+		problems = append(problems, fmt.Sprintf("%d services need firmware 9.6.0 or later, earlier versions allow 32.", len(services)))
+	}
+	for i := 0; i < len(services); i++ {
+		if (len(services[i]) > 8) {
+			problems = append(problems, fmt.Sprintf("Service %q is longer than 8 characters and is truncated.", services[i]))
+		}
+	}
+	problems = lintDuplicates(problems, "ServiceAccessControl", services)
+	problems = lintDuplicates(problems, "Dependency", formatItems("Dependency", reflect.ValueOf(rsf.SystemControlInfo.Dependency), rsf.SvcNames))
+	problems = lintDuplicates(problems, "SystemCallAccess", formatItems("SystemCallAccess", reflect.ValueOf(accessControlInfo.SystemCallAccess), rsf.SvcNames))
+
+	if (!accessControlInfo.UseExtSaveData && accessControlInfo.ExtSaveDataId != 0) {
+		problems = append(problems, "ExtSaveDataId is set but UseExtSaveData is false, so it is ignored.")
+	}
+	if (len(accessControlInfo.AccessibleSaveDataIds) > 0 && (accessControlInfo.OtherUserSaveDataId1 != 0 || accessControlInfo.OtherUserSaveDataId2 != 0 || accessControlInfo.OtherUserSaveDataId3 != 0 || accessControlInfo.UseExtSaveData)) {
+		problems = append(problems, "OtherUserSaveDataId and ExtSaveDataId are ignored when AccessibleSaveDataIds is set.")
+	}
+
+	_, err := rsf.Exheader()
+	if (err != nil) {
+		problems = append(problems, err.Error())
+	}
+	return
+}
+
+func lintDuplicates(problems []string, key string, items []string) []string {
+	seen := map[string]bool{}
+	for i := 0; i < len(items); i++ {
+		if (seen[items[i]]) {
+			problems = append(problems, fmt.Sprintf("%s lists %s more than once.", key, items[i]))
+		}
+		seen[items[i]] = true
+	}
+	return problems
+}
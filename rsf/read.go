@@ -0,0 +1,303 @@
+package rsf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Reader parses the YAML dialect makerom reads RSFs in.
+type Reader struct {
+	// Values for $(NAME) substitutions, as given to makerom with -DNAME=VALUE.
+	Vars map[string]string
+	// Keys that do not correspond to an Rsf field, as "Section/Key", filled by Read.
+	Unknown []string
+}
+
+// Read parses an RSF without variable substitutions.
+func Read(in io.Reader) (*Rsf, error) {
+	return (&Reader{}).Read(in)
+}
+
+// Read parses an RSF into the Rsf fields of the same name. Commented-out keys
+// are treated as absent and unknown keys are recorded in Unknown. Absent keys
+// of the sections in the RSF get the value makerom uses for them.
+func (reader *Reader) Read(in io.Reader) (*Rsf, error) {
+	rsf := &Rsf{}
+	root := reflect.ValueOf(rsf).Elem()
+	reader.Unknown = nil
+	present := map[string]bool{} // Sections and keys found, as "Section" and "Section/Key"
+
+	var section reflect.Value
+	var sectionName string
+	var list reflect.Value // Field receiving "- item" lines or "Name: value" entries
+	var listName string
+	listIndent := -1 // Indentation of the key owning the current list, -1 if none
+
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		raw := strings.TrimRight(strings.ReplaceAll(scanner.Text(), "\t", "  "), " \r")
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		text := stripComment(strings.TrimSpace(raw))
+		if (text == "") {
+			continue
+		}
+		text, err := reader.substitute(text)
+		if (err != nil) {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		isItem := text == "-" || strings.HasPrefix(text, "- ")
+		if (listIndent >= 0 && (indent > listIndent || (isItem && indent == listIndent))) {
+			value := strings.TrimSpace(strings.TrimPrefix(text, "-"))
+			if (!isItem) { // <Name>: <value> map entry, the value is what makerom uses
+				colon := strings.IndexByte(value, ':')
+				if (colon < 0) {
+					return nil, fmt.Errorf("line %d: expected - <item> or <name>: <value>", line)
+				}
+				value = strings.TrimSpace(value[colon + 1:])
+			}
+			if (list.IsValid() && value != "") {
+				err := appendItem(list, listName, value)
+				if (err != nil) {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+			}
+			continue
+		}
+		listIndent = -1
+
+		if (isItem && !section.IsValid() && sectionName != "" && indent > 0) { // Section read as a list, such as PlainRegion
+			continue
+		}
+		if (isItem) {
+			return nil, fmt.Errorf("line %d: list item outside of a list", line)
+		}
+		key, value, ok := splitKey(text)
+		if (!ok) {
+			return nil, fmt.Errorf("line %d: expected <key>: <value>", line)
+		}
+
+		if (indent == 0) { // Section
+			sectionName = key
+			present[key] = true
+			section = root.FieldByName(key)
+			if (!section.IsValid() || section.Kind() != reflect.Struct) {
+				section = reflect.Value{}
+				reader.Unknown = append(reader.Unknown, key)
+			}
+			continue
+		}
+		if (sectionName == "") {
+			return nil, fmt.Errorf("line %d: key outside of a section", line)
+		}
+
+		var field reflect.Value
+		if (section.IsValid()) {
+			field = section.FieldByName(key)
+		}
+		present[sectionName + "/" + key] = true
+		if (!field.IsValid()) {
+			reader.Unknown = append(reader.Unknown, sectionName + "/" + key)
+		}
+		if (value == "") { // Start of a list, or an empty value
+			list = field
+			listName = key
+			listIndent = indent
+			continue
+		}
+		if (!field.IsValid()) {
+			continue
+		}
+		err = setValue(field, key, value)
+		if (err != nil) {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	err := setDefaults(rsf, present)
+	if (err != nil) {
+		return nil, err
+	}
+	return rsf, nil
+}
+
+// Sets the keys with a default that are absent from present, in the sections
+// that are in it.
+func setDefaults(rsf *Rsf, present map[string]bool) error {
+	root := reflect.ValueOf(rsf).Elem()
+	for i := 0; i < len(schema); i++ {
+		name := schema[i].Name
+		if (!present[name]) {
+			continue
+		}
+		groups := schema[i].Groups
+		for j := 0; j < len(groups); j++ {
+			for k := 0; k < len(groups[j]); k++ {
+				key := &groups[j][k]
+				if (key.Default == nil || present[name + "/" + key.Name]) {
+					continue
+				}
+				err := setValue(root.FieldByName(name).FieldByName(key.Name), key.Name, key.Default(rsf))
+				if (err != nil) {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Replaces $(NAME) with its value from Vars.
+func (reader *Reader) substitute(text string) (string, error) {
+	for {
+		start := strings.Index(text, "$(")
+		if (start < 0) {
+			return text, nil
+		}
+		end := strings.IndexByte(text[start:], ')')
+		if (end < 0) {
+			return "", fmt.Errorf("unterminated $(")
+		}
+		name := text[start + 2:start + end]
+		value, ok := reader.Vars[name]
+		if (!ok) {
+			return "", fmt.Errorf("undefined variable $(%s)", name)
+		}
+		text = text[:start] + value + text[start + end + 1:]
+	}
+}
+
+// Splits "Key: value" or "Key : value", ignoring colons inside quotes.
+func splitKey(text string) (key string, value string, ok bool) {
+	colon := strings.IndexByte(text, ':')
+	if (colon <= 0 || strings.ContainsAny(text[:colon], "\"'")) {
+		return "", "", false
+	}
+	return strings.TrimSpace(text[:colon]), strings.TrimSpace(text[colon + 1:]), true
+}
+
+// Removes a trailing "# comment", keeping any inside quotes.
+func stripComment(text string) string {
+	if (strings.HasPrefix(text, "#")) {
+		return ""
+	}
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch {
+			case quote != 0:
+				if (text[i] == '\\' && quote == '"') {
+					i++
+				} else if (text[i] == quote) {
+					quote = 0
+				}
+			case text[i] == '"' || text[i] == '\'':
+				quote = text[i]
+			case text[i] == '#' && text[i - 1] == ' ':
+				return strings.TrimSpace(text[:i])
+		}
+	}
+	return text
+}
+
+func unquote(value string) (string, error) {
+	if (len(value) >= 2 && value[0] == '"' && value[len(value) - 1] == '"') {
+		return strconv.Unquote(value)
+	}
+	if (len(value) >= 2 && value[0] == '\'' && value[len(value) - 1] == '\'') {
+		return strings.ReplaceAll(value[1:len(value) - 1], "''", "'"), nil
+	}
+	return value, nil
+}
+
+// Parses hex with a 0x prefix and decimal otherwise, as makerom does.
+func parseNumber(value string, bits int) (uint64, error) {
+	if (strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X")) {
+		return strconv.ParseUint(value[2:], 16, bits)
+	}
+	return strconv.ParseUint(value, 10, bits)
+}
+
+// Parses sizes such as "512KB" into bytes.
+func parseSize(value string) (uint64, error) {
+	units := []struct {
+		suffix string
+		scale uint64
+	} {
+		{"KB", 1 << 10},
+		{"MB", 1 << 20},
+		{"GB", 1 << 30},
+	}
+	value = strings.ToUpper(strings.TrimSpace(value))
+	for i := 0; i < len(units); i++ {
+		if (strings.HasSuffix(value, units[i].suffix)) {
+			n, err := parseNumber(strings.TrimSpace(strings.TrimSuffix(value, units[i].suffix)), 64)
+			return n * units[i].scale, err
+		}
+	}
+	return parseNumber(value, 64)
+}
+
+func setValue(field reflect.Value, key string, value string) error {
+	value, err := unquote(value)
+	if (err != nil) {
+		return fmt.Errorf("%s: invalid string %s", key, value)
+	}
+	switch (field.Kind()) {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if (err != nil) {
+				return fmt.Errorf("%s: invalid bool %q", key, value)
+			}
+			field.SetBool(b)
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			var n uint64
+			var err error
+			if (key == "SaveDataSize") {
+				n, err = parseSize(value)
+			} else {
+				n, err = parseNumber(value, field.Type().Bits())
+			}
+			if (err != nil) {
+				return fmt.Errorf("%s: invalid number %q", key, value)
+			}
+			field.SetUint(n)
+		default:
+			return fmt.Errorf("%s: expected a list", key)
+	}
+	return nil
+}
+
+func appendItem(list reflect.Value, key string, value string) error {
+	if (key == "FileSystemAccess") { // Stored as a bitmask
+		name, err := unquote(value)
+		if (err != nil) {
+			return fmt.Errorf("%s: invalid string %s", key, value)
+		}
+		for bit, access := range filesystemAccessInfo {
+			if (access == name) {
+				list.SetUint(list.Uint() | (1 << bit))
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown FileSystemAccess %q", name)
+	}
+	if (list.Kind() != reflect.Slice) {
+		return fmt.Errorf("%s is not a list", key)
+	}
+
+	item := reflect.New(list.Type().Elem()).Elem()
+	err := setValue(item, key, value)
+	if (err != nil) {
+		return err
+	}
+	list.Set(reflect.Append(list, item))
+	return nil
+}
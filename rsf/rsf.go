@@ -0,0 +1,96 @@
+package rsf
+
+type Rsf struct {
+	BasicInfo struct { 
+		Title string
+		CompanyCode string
+		ProductCode string
+		ContentType string
+		Logo string
+	}
+	RomFs struct { 
+		RootPath string
+	//	Reject string
+	//	Include string
+	//	File string
+	}
+	TitleInfo struct {
+		Platform string
+		Category string
+		UniqueId uint32
+		Version uint8
+		ContentsIndex uint8
+		Variation uint8
+		ChildIndex uint8
+		DemoIndex uint8
+	//	TargetCategory string
+	//	CategoryFlags string
+	}
+	Option struct {
+	//	AllowUnalignedSection bool
+	//	MediaFootPadding bool
+		EnableCrypt bool
+		EnableCompress bool
+		FreeProductCode bool
+		UseOnSD bool
+	}
+	AccessControlInfo struct {
+		DisableDebug bool
+		EnableForceDebug bool
+		CanWriteSharedPage bool
+		CanUsePrivilegedPriority bool
+		CanUseNonAlphabetAndNumber bool
+		PermitMainFunctionArgument bool
+		CanShareDeviceMemory bool
+		UseOtherVariationSaveData bool
+		RunnableOnSleep bool
+		SpecialMemoryArrange bool
+		CanAccessCore2 bool
+		UseExtSaveData bool
+		EnableL2Cache bool
+
+		IdealProcessor byte
+		Priority byte
+		MemoryType string
+		SystemMode string
+		SystemModeExt string
+		CpuSpeed string
+		CoreVersion uint16
+		HandleTableSize  uint32
+		SystemSaveDataId1 uint32
+		SystemSaveDataId2 uint32
+		OtherUserSaveDataId1 uint32
+		OtherUserSaveDataId2 uint32
+		OtherUserSaveDataId3 uint32
+		ExtSaveDataId uint32
+		AffinityMask byte
+		DescVersion uint8
+		ResourceLimitCategory string
+		ReleaseKernelMajor uint8
+		ReleaseKernelMinor uint8
+		MaxCpu uint8
+
+		MemoryMapping []string
+		IORegisterMapping []string
+		FileSystemAccess uint32 // Bitmask handled by output
+		IoAccessControl []string
+		InterruptNumbers []uint8
+		SystemCallAccess []uint32
+		ServiceAccessControl []string
+		AccessibleSaveDataIds []uint32
+		OtherKernelCaps []uint32 // Descriptors makerom cannot write, kept as comments
+	}
+	SystemControlInfo struct {
+		AppType string
+		StackSize uint32
+		RemasterVersion uint16
+		JumpId uint64
+		SaveDataSize uint64
+		Dependency []uint64
+	}
+
+	Cfa bool // No exheader: AccessControlInfo and SystemControlInfo are not written
+	LogoFile string // Unknown logo extracted for makerom -logo, noted beside Logo
+	LogoUnknown bool // Logo is None because the logo is not a built-in one
+	SvcNames *SvcNames // Names written for SystemCallAccess, the built-in names when nil
+}
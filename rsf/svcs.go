@@ -0,0 +1,272 @@
+package rsf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SvcNames are the names written for the system call IDs a kernel capability
+// descriptor can grant: 8 masks of 24 IDs.
+type SvcNames [24 * 8]string
+
+// The official names, with the Luma3DS custom SVCs from 0x80.
+var builtinSvcNames = SvcNames {
+	"",                                  // 00
+	"ControlMemory",                     // 01
+	"QueryMemory",                       // 02
+	"ExitProcess",                       // 03
+	"GetProcessAffinityMask",            // 04
+	"SetProcessAffinityMask",            // 05
+	"GetProcessIdealProcessor",          // 06
+	"SetProcessIdealProcessor",          // 07
+	"CreateThread",                      // 08
+	"ExitThread",                        // 09
+	"SleepThread",                       // 0A
+	"GetThreadPriority",                 // 0B
+	"SetThreadPriority",                 // 0C
+	"GetThreadAffinityMask",             // 0D
+	"SetThreadAffinityMask",             // 0E
+	"GetThreadIdealProcessor",           // 0F
+	"SetThreadIdealProcessor",           // 10
+	"GetCurrentProcessorNumber",         // 11
+	"Run",                               // 12
+	"CreateMutex",                       // 13
+	"ReleaseMutex",                      // 14
+	"CreateSemaphore",                   // 15
+	"ReleaseSemaphore",                  // 16
+	"CreateEvent",                       // 17
+	"SignalEvent",                       // 18
+	"ClearEvent",                        // 19
+	"CreateTimer",                       // 1A
+	"SetTimer",                          // 1B
+	"CancelTimer",                       // 1C
+	"ClearTimer",                        // 1D
+	"CreateMemoryBlock",                 // 1E
+	"MapMemoryBlock",                    // 1F
+	"UnmapMemoryBlock",                  // 20
+	"CreateAddressArbiter",              // 21
+	"ArbitrateAddress",                  // 22
+	"CloseHandle",                       // 23
+	"WaitSynchronization1",              // 24
+	"WaitSynchronizationN",              // 25
+	"SignalAndWait",                     // 26
+	"DuplicateHandle",                   // 27
+	"GetSystemTick",                     // 28
+	"GetHandleInfo",                     // 29
+	"GetSystemInfo",                     // 2A
+	"GetProcessInfo",                    // 2B
+	"GetThreadInfo",                     // 2C
+	"ConnectToPort",                     // 2D
+	"SendSyncRequest1",                  // 2E
+	"SendSyncRequest2",                  // 2F
+	"SendSyncRequest3",                  // 30
+	"SendSyncRequest4",                  // 31
+	"SendSyncRequest",                   // 32
+	"OpenProcess",                       // 33
+	"OpenThread",                        // 34
+	"GetProcessId",                      // 35
+	"GetProcessIdOfThread",              // 36
+	"GetThreadId",                       // 37
+	"GetResourceLimit",                  // 38
+	"GetResourceLimitLimitValues",       // 39
+	"GetResourceLimitCurrentValues",     // 3A
+	"GetThreadContext",                  // 3B
+	"Break",                             // 3C
+	"OutputDebugString",                 // 3D
+	"ControlPerformanceCounter",         // 3E
+	"",                                  // 3F
+	"",                                  // 40
+	"",                                  // 41
+	"",                                  // 42
+	"",                                  // 43
+	"",                                  // 44
+	"",                                  // 45
+	"",                                  // 46
+	"CreatePort",                        // 47
+	"CreateSessionToPort",               // 48
+	"CreateSession",                     // 49
+	"AcceptSession",                     // 4A
+	"ReplyAndReceive1",                  // 4B
+	"ReplyAndReceive2",                  // 4C
+	"ReplyAndReceive3",                  // 4D
+	"ReplyAndReceive4",                  // 4E
+	"ReplyAndReceive",                   // 4F
+	"BindInterrupt",                     // 50
+	"UnbindInterrupt",                   // 51
+	"InvalidateProcessDataCache",        // 52
+	"StoreProcessDataCache",             // 53
+	"FlushProcessDataCache",             // 54
+	"StartInterProcessDma",              // 55
+	"StopDma",                           // 56
+	"GetDmaState",                       // 57
+	"RestartDma",                        // 58
+	"SetGpuProt",                        // 59
+	"SetWifiEnabled",                    // 5A
+	"",                                  // 5B
+	"",                                  // 5C
+	"",                                  // 5D
+	"",                                  // 5E
+	"",                                  // 5F
+	"DebugActiveProcess",                // 60
+	"BreakDebugProcess",                 // 61
+	"TerminateDebugProcess",             // 62
+	"GetProcessDebugEvent",              // 63
+	"ContinueDebugEvent",                // 64
+	"GetProcessList",                    // 65
+	"GetThreadList",                     // 66
+	"GetDebugThreadContext",             // 67
+	"SetDebugThreadContext",             // 68
+	"QueryDebugProcessMemory",           // 69
+	"ReadProcessMemory",                 // 6A
+	"WriteProcessMemory",                // 6B
+	"SetHardwareBreakPoint",             // 6C
+	"GetDebugThreadParam",               // 6D
+	"",                                  // 6E
+	"",                                  // 6F
+	"ControlProcessMemory",              // 70
+	"MapProcessMemory",                  // 71
+	"UnmapProcessMemory",                // 72
+	"CreateCodeSet",                     // 73
+	"",                                  // 74
+	"CreateProcess",                     // 75
+	"TerminateProcess",                  // 76
+	"SetProcessResourceLimits",          // 77
+	"CreateResourceLimit",               // 78
+	"SetResourceLimitValues",            // 79
+	"AddCodeSegment",                    // 7A
+	"Backdoor",                          // 7B
+	"KernelSetState",                    // 7C
+	"QueryProcessMemory",                // 7D
+	"",                                  // 7E
+	"",                                  // 7F
+	"CustomBackdoor",                    // 80
+	"",                                  // 81
+	"",                                  // 82
+	"",                                  // 83
+	"",                                  // 84
+	"",                                  // 85
+	"",                                  // 86
+	"",                                  // 87
+	"",                                  // 88
+	"",                                  // 89
+	"",                                  // 8A
+	"",                                  // 8B
+	"",                                  // 8C
+	"",                                  // 8D
+	"",                                  // 8E
+	"",                                  // 8F
+	"ConvertVAToPA",                     // 90
+	"FlushDataCacheRange",               // 91
+	"FlushEntireDataCache",              // 92
+	"InvalidateInstructionCacheRange",   // 93
+	"InvalidateEntireInstructionCache",  // 94
+	"",                                  // 95
+	"",                                  // 96
+	"",                                  // 97
+	"",                                  // 98
+	"",                                  // 99
+	"",                                  // 9A
+	"",                                  // 9B
+	"",                                  // 9C
+	"",                                  // 9D
+	"",                                  // 9E
+	"",                                  // 9F
+	"MapProcessMemoryEx",                // A0
+	"UnmapProcessMemoryEx",              // A1
+	"ControlMemoryEx",                   // A2
+	"ControlMemoryUnsafe",               // A3
+	"",                                  // A4
+	"",                                  // A5
+	"",                                  // A6
+	"",                                  // A7
+	"",                                  // A8
+	"",                                  // A9
+	"",                                  // AA
+	"",                                  // AB
+	"",                                  // AC
+	"",                                  // AD
+	"",                                  // AE
+	"",                                  // AF
+	"ControlService",                    // B0
+	"CopyHandle",                        // B1
+	"TranslateHandle",                   // B2
+	"ControlProcess",                    // B3
+	"",                                  // B4
+	"",                                  // B5
+	"",                                  // B6
+	"",                                  // B7
+	"",                                  // B8
+	"",                                  // B9
+	"",                                  // BA
+	"",                                  // BB
+	"",                                  // BC
+	"",                                  // BD
+	"",                                  // BE
+	"",                                  // BF
+}
+
+// Name returns the RSF name of a system call, or a placeholder for IDs with
+// no known name. makerom only reads the ID. A nil table has the built-in
+// names.
+func (names *SvcNames) Name(id uint32) string {
+	if (names == nil) {
+		names = &builtinSvcNames
+	}
+	if (id < uint32(len(names)) && names[id] != "") {
+		return names[id]
+	}
+	return fmt.Sprintf("Svc%02X", id)
+}
+
+// LoadSvcNames reads a file of system call names, one <ID>=<name> per line,
+// and returns the built-in names with those IDs replaced.
+func LoadSvcNames(path string) (*SvcNames, error) {
+	file, err := os.Open(path)
+	if (err != nil) {
+		return nil, err
+	}
+	defer file.Close()
+
+	names := builtinSvcNames
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if (text == "" || text[0] == '#') {
+			continue
+		}
+		eq := strings.IndexByte(text, '=')
+		if (eq < 0) {
+			return nil, fmt.Errorf("%s:%d: expected <ID>=<name>", path, line)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(text[:eq]), 0, 32)
+		if (err != nil || id >= uint64(len(names))) {
+			return nil, fmt.Errorf("%s:%d: ID must be a number below 0x%X", path, line, len(names))
+		}
+		name := strings.TrimSpace(text[eq + 1:])
+		if (!validSvcName(name)) {
+			return nil, fmt.Errorf("%s:%d: name must be letters, digits and underscores", path, line)
+		}
+		names[id] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &names, nil
+}
+
+// Whether name can be written as an RSF key without quotes.
+func validSvcName(name string) bool {
+	if (name == "") {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if (!(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package rsf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Each loaded table only replaces its own names.
+func TestLoadSvcNames(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.txt"), filepath.Join(dir, "second.txt")
+	if err := os.WriteFile(first, []byte("0x01=Allocate\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("# Comment\n2 = Query\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := LoadSvcNames(first)
+	if (err != nil) {
+		t.Fatal(err)
+	}
+	b, err := LoadSvcNames(second)
+	if (err != nil) {
+		t.Fatal(err)
+	}
+
+	var builtin *SvcNames
+	tests := []struct {
+		names *SvcNames
+		id uint32
+		name string
+	}{
+		{a, 1, "Allocate"},
+		{a, 2, "QueryMemory"},
+		{b, 1, "ControlMemory"},
+		{b, 2, "Query"},
+		{builtin, 1, "ControlMemory"},
+		{builtin, 0x3F, "Svc3F"},
+	}
+	for i := 0; i < len(tests); i++ {
+		if name := tests[i].names.Name(tests[i].id); name != tests[i].name {
+			t.Errorf("Test %d: Name(0x%02X) = %s, expected %s", i, tests[i].id, name, tests[i].name)
+		}
+	}
+}
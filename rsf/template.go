@@ -0,0 +1,120 @@
+package rsf
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// Names of the built-in templates: makerom's full RSF, only the keys taken
+// from the title, and the devkitPro homebrew layout.
+var TemplateNames = []string{"full", "minimal", "homebrew"}
+
+func schemaKey(name string) (*key, error) {
+	for i := 0; i < len(schema); i++ {
+		groups := schema[i].Groups
+		for j := 0; j < len(groups); j++ {
+			for k := 0; k < len(groups[j]); k++ {
+				if (groups[j][k].Name == name) {
+					return &groups[j][k], nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("Unknown RSF key %q.", name)
+}
+
+// Functions available to templates. Keys are looked up in schema, so values
+// are formatted and escaped the same way Write does.
+var templateFuncs = template.FuncMap {
+	"value": func(rsf *Rsf, name string) (string, error) {
+		k, err := schemaKey(name)
+		if (err != nil) {
+			return "", err
+		}
+		switch k.Type {
+			case typeString:
+				return quotes(k.Get(rsf)), nil
+			case typeScalar:
+				return scalar(k.Get(rsf)), nil
+		}
+		return "", fmt.Errorf("%s is a list, use items.", name)
+	},
+	"items": func(rsf *Rsf, name string) ([]item, error) {
+		k, err := schemaKey(name)
+		if (err != nil) {
+			return nil, err
+		}
+		if (k.Items == nil) {
+			return nil, fmt.Errorf("%s is not a list, use value.", name)
+		}
+		return k.Items(rsf), nil
+	},
+	"note": func(rsf *Rsf, name string) (string, error) {
+		k, err := schemaKey(name)
+		if (err != nil) {
+			return "", err
+		}
+		return k.note(rsf), nil
+	},
+	"omit": func(rsf *Rsf, name string) (bool, error) {
+		k, err := schemaKey(name)
+		if (err != nil) {
+			return false, err
+		}
+		return k.Omit != nil && k.Omit(rsf), nil
+	},
+	"disabled": func(rsf *Rsf, name string) (bool, error) {
+		k, err := schemaKey(name)
+		if (err != nil) {
+			return false, err
+		}
+		return k.Disabled != nil && k.Disabled(rsf), nil
+	},
+	"default": func(rsf *Rsf, name string) (bool, error) {
+		k, err := schemaKey(name)
+		if (err != nil) {
+			return false, err
+		}
+		if (k.Items != nil) {
+			return len(k.Items(rsf)) == 0, nil
+		}
+		return k.Default != nil && strings.EqualFold(k.Get(rsf), k.Default(rsf)), nil
+	},
+	"enabled": func(items []item) []item {
+		var out []item
+		for i := 0; i < len(items); i++ {
+			if (!items[i].Disabled) {
+				out = append(out, items[i])
+			}
+		}
+		return out
+	},
+	"list": func(values ...string) []string {
+		return values
+	},
+	"quote": quotes,
+	"scalar": scalar,
+}
+
+// LoadTemplate returns the built-in template called name, or else parses the
+// template file at path name.
+func LoadTemplate(name string) (*template.Template, error) {
+	for i := 0; i < len(TemplateNames); i++ {
+		if (TemplateNames[i] == name) {
+			return template.New(name + ".tmpl").Funcs(templateFuncs).ParseFS(builtinTemplates, "templates/" + name + ".tmpl")
+		}
+	}
+	return template.New(filepath.Base(name)).Funcs(templateFuncs).ParseFiles(name)
+}
+
+// WriteTemplate writes rsf rendered through tmpl.
+func WriteTemplate(w io.Writer, rsf *Rsf, tmpl *template.Template) error {
+	return tmpl.Execute(w, rsf)
+}
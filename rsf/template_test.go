@@ -0,0 +1,41 @@
+package rsf
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Keys a template leaves out or comments out must read back as the title's
+// values, as the homebrew template does for keys equal to their default.
+func TestTemplatesReadBack(t *testing.T) {
+	other := defaultTitle(t) // Every key with a default set to another value
+	other.BasicInfo.CompanyCode = "01"
+	other.BasicInfo.ContentType = "SystemUpdate"
+	other.TitleInfo.Platform = "snake"
+	other.AccessControlInfo.ResourceLimitCategory = "sysapplet"
+	other.SystemControlInfo.AppType = "system"
+	other.SystemControlInfo.JumpId = 0x0004001000022000
+	titles := []*Rsf{defaultTitle(t), other}
+
+	for i := 0; i < len(titles); i++ {
+		for j := 0; j < len(TemplateNames); j++ {
+			tmpl, err := LoadTemplate(TemplateNames[j])
+			if (err != nil) {
+				t.Fatal(err)
+			}
+			out := &bytes.Buffer{}
+			err = WriteTemplate(out, titles[i], tmpl)
+			if (err != nil) {
+				t.Fatal(err)
+			}
+			read, err := Read(out)
+			if (err != nil) {
+				t.Fatalf("%s: %v", TemplateNames[j], err)
+			}
+			changes := Diff(titles[i], read)
+			for k := 0; k < len(changes); k++ {
+				t.Errorf("%s, title %d: %s/%s: %q -> %q", TemplateNames[j], i, changes[k].Section, changes[k].Key, changes[k].Old, changes[k].New)
+			}
+		}
+	}
+}
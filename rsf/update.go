@@ -0,0 +1,259 @@
+package rsf
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// A list key being collected by Update.
+type updateList struct {
+	section string
+	key string
+	field reflect.Value
+	line int // Line of the key
+	items []int // Lines of the items
+	commented []int // Commented out lines inside the list
+}
+
+// Update rewrites the RSF read from in so that its values match r, writing the
+// result to w. Only keys already in the file are changed, and only when their
+// value differs: comments, key order and other keys are kept. Removed list
+// items are commented out, and added ones are uncommented when the file has
+// them commented out. Keys using $(NAME) are left alone and returned in kept
+// as Section/Key. Logo is left alone when r.LogoUnknown is set.
+func Update(in io.Reader, w io.Writer, r *Rsf) (changes []Change, kept []string, err error) {
+	var lines []string
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	root := reflect.ValueOf(r).Elem()
+	inserts := map[int][]string{} // Lines added after the given line
+	var section reflect.Value
+	var sectionName string
+	var list *updateList
+	listIndent := -1
+	finish := func() {
+		if (list != nil) {
+			changes, kept = updateItems(lines, inserts, list, r, changes, kept)
+		}
+		list = nil
+		listIndent = -1
+	}
+
+	for i := 0; i < len(lines); i++ {
+		raw := strings.TrimRight(strings.ReplaceAll(lines[i], "\t", "  "), " \r")
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		text := stripComment(strings.TrimSpace(raw))
+		isItem := text == "-" || strings.HasPrefix(text, "- ")
+		if (listIndent >= 0) {
+			if (text == "") {
+				if (strings.HasPrefix(strings.TrimSpace(raw), "#") && list != nil) {
+					list.commented = append(list.commented, i)
+				}
+				continue
+			}
+			if (indent > listIndent || (isItem && indent == listIndent)) {
+				if (list != nil) {
+					list.items = append(list.items, i)
+				}
+				continue
+			}
+			finish()
+		}
+		if (text == "" || isItem) {
+			continue
+		}
+		key, value, ok := splitKey(text)
+		if (!ok) {
+			continue
+		}
+
+		if (indent == 0) {
+			sectionName = key
+			section = root.FieldByName(key)
+			if (section.Kind() != reflect.Struct) {
+				section = reflect.Value{}
+			}
+			continue
+		}
+		var field reflect.Value
+		if (section.IsValid()) {
+			field = section.FieldByName(key)
+		}
+		if (value == "") {
+			listIndent = indent
+			if (field.IsValid() && (field.Kind() == reflect.Slice || key == "FileSystemAccess")) {
+				list = &updateList{section: sectionName, key: key, field: field, line: i}
+			}
+			continue
+		}
+		if (!field.IsValid() || field.Kind() == reflect.Slice || key == "FileSystemAccess") {
+			continue
+		}
+		if (key == "Logo" && r.LogoUnknown) { // None would lose a hand-set logo
+			continue
+		}
+		if (strings.Contains(value, "$(")) {
+			kept = append(kept, sectionName + "/" + key)
+			continue
+		}
+
+		old := reflect.New(field.Type()).Elem()
+		if (setValue(old, key, value) == nil && reflect.DeepEqual(old.Interface(), field.Interface())) {
+			continue
+		}
+		k, err := schemaKey(key)
+		if (err != nil) {
+			continue
+		}
+		newValue := scalar(k.Get(r))
+		if (k.Type == typeString) {
+			newValue = quotes(k.Get(r))
+		}
+		colon := strings.IndexByte(lines[i], ':')
+		start := strings.Index(lines[i][colon + 1:], value)
+		if (start < 0) {
+			continue
+		}
+		start += colon + 1
+		lines[i] = lines[i][:start] + newValue + lines[i][start + len(value):]
+		changes = append(changes, Change{sectionName, key, formatValue(key, old, r.SvcNames), formatValue(key, field, r.SvcNames)})
+	}
+	finish()
+
+	buf := bufio.NewWriter(w)
+	for i := 0; i < len(lines); i++ {
+		buf.WriteString(lines[i] + "\n")
+		for j := 0; j < len(inserts[i]); j++ {
+			buf.WriteString(inserts[i][j] + "\n")
+		}
+	}
+	return changes, kept, buf.Flush()
+}
+
+// Returns the value of a list item line, or "" if it is not one.
+func itemValue(text string) string {
+	text = stripComment(strings.TrimSpace(text))
+	if (strings.HasPrefix(text, "-")) {
+		return strings.TrimSpace(text[1:])
+	}
+	colon := strings.IndexByte(text, ':')
+	if (colon < 0) {
+		return ""
+	}
+	return strings.TrimSpace(text[colon + 1:])
+}
+
+// Returns the item in the form compared by Diff.
+func itemIdentity(field reflect.Value, key string, value string, names *SvcNames) string {
+	if (key == "FileSystemAccess") {
+		name, err := unquote(value)
+		if (err != nil) {
+			return value
+		}
+		return name
+	}
+	item := reflect.New(field.Type().Elem()).Elem()
+	if (setValue(item, key, value) != nil) {
+		return value
+	}
+	return formatValue(key, item, names)
+}
+
+func updateItems(lines []string, inserts map[int][]string, list *updateList, r *Rsf, changes []Change, kept []string) ([]Change, []string) {
+	existing := map[string]int{} // Identity to line
+	for i := 0; i < len(list.items); i++ {
+		value := itemValue(lines[list.items[i]])
+		if (strings.Contains(value, "$(")) {
+			return changes, append(kept, list.section + "/" + list.key)
+		}
+		existing[itemIdentity(list.field, list.key, value, r.SvcNames)] = list.items[i]
+	}
+
+	var wanted []string
+	if (list.key == "FileSystemAccess") {
+		wanted = fileSystemAccessNames(uint32(list.field.Uint()))
+	} else {
+		wanted = formatItems(list.key, list.field, r.SvcNames)
+	}
+	isWanted := map[string]bool{}
+	for i := 0; i < len(wanted); i++ {
+		isWanted[wanted[i]] = true
+	}
+
+	for i := 0; i < len(list.items); i++ {
+		line := list.items[i]
+		identity := itemIdentity(list.field, list.key, itemValue(lines[line]), r.SvcNames)
+		if (!isWanted[identity]) {
+			lines[line] = "#" + lines[line]
+			changes = append(changes, Change{list.section, list.key, identity, ""})
+		}
+	}
+
+	// Lines for added items are written as Write would, indented like the existing items.
+	k, _ := schemaKey(list.key)
+	var items []item
+	if (k != nil) {
+		items = k.Items(r)
+	}
+	last := list.line
+	if (len(list.items) > 0) {
+		last = list.items[len(list.items) - 1]
+	}
+	for i := 0; i < len(wanted); i++ {
+		if _, ok := existing[wanted[i]]; ok {
+			continue
+		}
+		added := uncomment(lines, list, wanted[i], r.SvcNames)
+		for j := 0; j < len(items) && !added; j++ {
+			if (items[j].Disabled || itemIdentity(list.field, list.key, items[j].Value, r.SvcNames) != wanted[i]) {
+				continue
+			}
+			inserts[last] = append(inserts[last], itemLine(lines, list, k.Type, &items[j]))
+			added = true
+		}
+		if (added) { // Items Write leaves out, such as unnamed SVCs, are not added either
+			changes = append(changes, Change{list.section, list.key, "", wanted[i]})
+		}
+	}
+	return changes, kept
+}
+
+// Uncomments a commented out item matching identity.
+func uncomment(lines []string, list *updateList, identity string, names *SvcNames) bool {
+	for i := 0; i < len(list.commented); i++ {
+		line := lines[list.commented[i]]
+		hash := strings.IndexByte(line, '#')
+		value := itemValue(line[hash + 1:])
+		if (value == "" || itemIdentity(list.field, list.key, value, names) != identity) {
+			continue
+		}
+		lines[list.commented[i]] = line[:hash] + line[hash + 1:]
+		return true
+	}
+	return false
+}
+
+func itemLine(lines []string, list *updateList, t valueType, it *item) string {
+	if (t == typeMap) {
+		indent := "    "
+		if (len(list.items) > 0) {
+			line := lines[list.items[0]]
+			indent = line[:len(line) - len(strings.TrimLeft(line, " #"))]
+		}
+		return strings.TrimLeft(indent, "#") + scalar(it.Key) + ": " + scalar(it.Value)
+	}
+	prefix := "     - "
+	if (len(list.items) > 0) {
+		line := lines[list.items[0]]
+		prefix = strings.TrimLeft(line[:strings.IndexByte(line, '-') + 1], "#") + " "
+	}
+	return prefix + scalar(it.Value)
+}
@@ -0,0 +1,355 @@
+package rsf
+
+import (
+	"fmt"
+	"io"
+)
+
+var filesystemAccessInfo = map[byte]string {
+	0: "CategorySystemApplication",
+	1: "CategoryHardwareCheck",
+	2: "CategoryFileSystemTool",
+	3: "Debug",
+	4: "TwlCardBackup",
+	5: "TwlNandData",
+	6: "Boss",
+	7: "DirectSdmc",
+	8: "Core",
+	9: "CtrNandRo",
+	10: "CtrNandRw",
+	11: "CtrNandRoWrite",
+	12: "CategorySystemSettings",
+	13: "CardBoard",
+	14: "ExportImportIvs",
+	15: "DirectSdmcWrite",
+	16: "SwitchCleanup",
+	17: "SaveDataMove",
+	18: "Shop",
+	19: "Shell",
+	20: "CategoryHomeMenu",
+	21: "SeedDB",
+}
+
+var dependencies = map[uint64]string {
+	0x0004013000002402: "ac",
+	0x0004013000003802: "act",
+	0x0004013000001502: "am",
+	0x0004013000003402: "boss",
+	0x0004013000001602: "camera",
+	0x0004013000002602: "cecd",
+	0x0004013000001702: "cfg",
+	0x0004013000001802: "codec",
+	0x0004013000002702: "csnd",
+	0x0004013000002802: "dlp",
+	0x0004013000001a02: "dsp",
+	0x0004013000003202: "friends",
+	0x0004013000001b02: "gpio",
+	0x0004013000001c02: "gsp",
+	0x0004013000001d02: "hid",
+	0x0004013000002902: "http",
+	0x0004013000001e02: "i2c",
+	0x0004013000003302: "ir",
+	0x0004013000001f02: "mcu",
+	0x0004013000002002: "mic",
+	0x0004013000002b02: "ndm",
+	0x0004013000003502: "news",
+	0x0004013000004002: "nfc",
+	0x0004013000002c02: "nim",
+	0x0004013000002d02: "nwm",
+	0x0004013000002102: "pdn",
+	0x0004013000003102: "ps",
+	0x0004013000002202: "ptm",
+	0x0004013020004202: "qtm",
+	0x0004013000003702: "ro",
+	0x0004013000002e02: "socket",
+	0x0004013000002302: "spi",
+	0x0004013000002f02: "ssl",
+}
+
+func hex(in interface{})(out string) {
+	out = fmt.Sprintf("0x%x", in)
+	return
+}
+
+func hexFill(in interface{}, length int)(out string) {
+	out = fmt.Sprintf("0x%0*x", length, in)
+	return
+}
+
+func dec(in interface{})(out string) {
+	out = fmt.Sprintf("%d", in)
+	return
+}
+
+func size(in uint64)(out string) {
+	if (in % 1024 == 0) {
+		out = dec(in / 1024) + "KB"
+	} else {
+		out = dec(in)
+	}
+	return
+}
+
+func truth(in bool)(out string) {
+	if (in) {
+		out = "true"
+	} else {
+		out = "false"
+	}
+	return
+}
+
+
+func stringItems(values []string) []item {
+	items := make([]item, len(values))
+	for i := 0; i < len(values); i++ {
+		items[i].Value = values[i]
+	}
+	return items
+}
+
+func hexItems(values []uint32) []item {
+	items := make([]item, len(values))
+	for i := 0; i < len(values); i++ {
+		items[i].Value = hex(values[i])
+	}
+	return items
+}
+
+// Only one of the keys making up the title ID's variation byte is written.
+func variationName(rsf *Rsf) string {
+	titleInfo := &rsf.TitleInfo
+	switch {
+		case titleInfo.ContentsIndex != 0:
+			return "ContentsIndex"
+		case titleInfo.Variation != 0:
+			return "Variation"
+		case titleInfo.ChildIndex != 0:
+			return "ChildIndex"
+		case titleInfo.DemoIndex != 0:
+			return "DemoIndex"
+	}
+	return "Version"
+}
+
+func variationKey(name string, get func(rsf *Rsf) uint8) key {
+	return key{Name: name, Type: typeScalar,
+		Get: func(rsf *Rsf) string { return hexFill(get(rsf), 2) },
+		Omit: func(rsf *Rsf) bool { return variationName(rsf) != name }}
+}
+
+func boolKey(name string, get func(rsf *Rsf) bool) key {
+	return key{Name: name, Type: typeScalar, Get: func(rsf *Rsf) string { return truth(get(rsf)) }}
+}
+
+// Points makerom at an extracted logo.
+func logoNote(rsf *Rsf) string {
+	if (rsf.LogoFile == "") {
+		return ""
+	}
+	return "Custom logo, build with makerom -logo " + rsf.LogoFile
+}
+
+var schema = []section {
+	{"BasicInfo", [][]key {{
+		{Name: "Title", Type: typeString, Get: func(rsf *Rsf) string { return rsf.BasicInfo.Title }},
+		{Name: "CompanyCode", Type: typeString, Get: func(rsf *Rsf) string { return rsf.BasicInfo.CompanyCode },
+			Default: func(rsf *Rsf) string { return "00" }},
+		{Name: "ProductCode", Type: typeString, Get: func(rsf *Rsf) string { return rsf.BasicInfo.ProductCode }},
+		{Name: "ContentType", Type: typeString, Get: func(rsf *Rsf) string { return rsf.BasicInfo.ContentType },
+			Default: func(rsf *Rsf) string { return "Application" }},
+		{Name: "Logo", Type: typeScalar, Note: "Nintendo / Licensed / Distributed / iQue / iQueForSystem",
+			Get: func(rsf *Rsf) string { return rsf.BasicInfo.Logo }, GetNote: logoNote},
+	}}},
+	{"RomFs", [][]key {{
+		{Name: "RootPath", Type: typeScalar, Get: func(rsf *Rsf) string { return rsf.RomFs.RootPath },
+			Disabled: func(rsf *Rsf) bool { return rsf.RomFs.RootPath == "" }},
+	}}},
+	{"TitleInfo", [][]key {{
+		{Name: "Platform", Type: typeScalar, Get: func(rsf *Rsf) string { return rsf.TitleInfo.Platform },
+			Default: func(rsf *Rsf) string { return "CTR" }},
+		{Name: "Category", Type: typeScalar, Get: func(rsf *Rsf) string { return rsf.TitleInfo.Category }},
+		{Name: "UniqueId", Type: typeScalar, Get: func(rsf *Rsf) string { return hexFill(rsf.TitleInfo.UniqueId, 6) }},
+		variationKey("ContentsIndex", func(rsf *Rsf) uint8 { return rsf.TitleInfo.ContentsIndex }),
+		variationKey("Variation", func(rsf *Rsf) uint8 { return rsf.TitleInfo.Variation }),
+		variationKey("ChildIndex", func(rsf *Rsf) uint8 { return rsf.TitleInfo.ChildIndex }),
+		variationKey("DemoIndex", func(rsf *Rsf) uint8 { return rsf.TitleInfo.DemoIndex }),
+		variationKey("Version", func(rsf *Rsf) uint8 { return rsf.TitleInfo.Version }),
+	}}},
+	{"Option", [][]key {{
+		boolKey("EnableCrypt", func(rsf *Rsf) bool { return rsf.Option.EnableCrypt }),
+		boolKey("EnableCompress", func(rsf *Rsf) bool { return rsf.Option.EnableCompress }),
+		boolKey("FreeProductCode", func(rsf *Rsf) bool { return rsf.Option.FreeProductCode }),
+		boolKey("UseOnSD", func(rsf *Rsf) bool { return rsf.Option.UseOnSD }),
+	}}},
+	{"AccessControlInfo", [][]key {
+		{
+			{Name: "CoreVersion", Type: typeScalar, Get: func(rsf *Rsf) string { return dec(rsf.AccessControlInfo.CoreVersion) }},
+		},
+		{
+			{Name: "DescVersion", Type: typeScalar, Comments: []string{"Exheader Format Version"},
+				Get: func(rsf *Rsf) string { return dec(rsf.AccessControlInfo.DescVersion) }},
+		},
+		{
+			{Name: "ReleaseKernelMajor", Type: typeString, Comments: []string{"Minimum Required Kernel Version"},
+				Get: func(rsf *Rsf) string { return dec(rsf.AccessControlInfo.ReleaseKernelMajor) }},
+			{Name: "ReleaseKernelMinor", Type: typeString, Get: func(rsf *Rsf) string { return dec(rsf.AccessControlInfo.ReleaseKernelMinor) }},
+		},
+		{
+			{Name: "UseExtSaveData", Type: typeScalar, Comments: []string{"ExtData"},
+				Get: func(rsf *Rsf) string { return truth(rsf.AccessControlInfo.UseExtSaveData) }},
+			{Name: "ExtSaveDataId", Type: typeScalar, Get: func(rsf *Rsf) string { return hex(rsf.AccessControlInfo.ExtSaveDataId) },
+				Disabled: func(rsf *Rsf) bool { return !rsf.AccessControlInfo.UseExtSaveData }},
+		},
+		{
+			{Name: "SystemSaveDataId1", Type: typeScalar, Get: func(rsf *Rsf) string { return hex(rsf.AccessControlInfo.SystemSaveDataId1) },
+				Omit: func(rsf *Rsf) bool { return rsf.AccessControlInfo.SystemSaveDataId1 == 0 }},
+			{Name: "SystemSaveDataId2", Type: typeScalar, Get: func(rsf *Rsf) string { return hex(rsf.AccessControlInfo.SystemSaveDataId2) },
+				Omit: func(rsf *Rsf) bool { return rsf.AccessControlInfo.SystemSaveDataId1 == 0 || rsf.AccessControlInfo.SystemSaveDataId2 == 0 }},
+			{Name: "OtherUserSaveDataId1", Type: typeScalar, Get: func(rsf *Rsf) string { return hex(rsf.AccessControlInfo.OtherUserSaveDataId1) },
+				Omit: func(rsf *Rsf) bool { return rsf.AccessControlInfo.OtherUserSaveDataId1 == 0 }},
+			{Name: "OtherUserSaveDataId2", Type: typeScalar, Get: func(rsf *Rsf) string { return hex(rsf.AccessControlInfo.OtherUserSaveDataId2) },
+				Omit: func(rsf *Rsf) bool { return rsf.AccessControlInfo.OtherUserSaveDataId2 == 0 }},
+			{Name: "OtherUserSaveDataId3", Type: typeScalar, Get: func(rsf *Rsf) string { return hex(rsf.AccessControlInfo.OtherUserSaveDataId3) },
+				Omit: func(rsf *Rsf) bool { return rsf.AccessControlInfo.OtherUserSaveDataId3 == 0 }},
+			{Name: "AccessibleSaveDataIds", Type: typeList, Items: func(rsf *Rsf) []item { return hexItems(rsf.AccessControlInfo.AccessibleSaveDataIds) },
+				Omit: func(rsf *Rsf) bool { return len(rsf.AccessControlInfo.AccessibleSaveDataIds) == 0 }},
+		},
+		{
+			{Name: "FileSystemAccess", Type: typeList, Comments: []string{"FS:USER Archive Access Permissions", "Uncomment as required"},
+				Items: func(rsf *Rsf) []item {
+					items := make([]item, 22)
+					for i := 0; i < len(items); i++ {
+						items[i].Value = filesystemAccessInfo[byte(i)]
+						items[i].Disabled = rsf.AccessControlInfo.FileSystemAccess & (1 << i) == 0
+					}
+					return items
+				}},
+		},
+		{
+			{Name: "IoAccessControl", Type: typeList, Items: func(rsf *Rsf) []item { return stringItems(rsf.AccessControlInfo.IoAccessControl) },
+				Omit: func(rsf *Rsf) bool { return len(rsf.AccessControlInfo.IoAccessControl) == 0 }},
+		},
+		{
+			{Name: "MemoryType", Type: typeScalar, Comments: []string{"Process Settings"}, Note: "Application/System/Base",
+				Get: func(rsf *Rsf) string { return rsf.AccessControlInfo.MemoryType }},
+			{Name: "ResourceLimitCategory", Type: typeScalar, Note: "Application/Sysapplet/Libapplet/Other",
+				Get: func(rsf *Rsf) string { return rsf.AccessControlInfo.ResourceLimitCategory },
+				Default: func(rsf *Rsf) string { return "application" }},
+			{Name: "SystemMode", Type: typeScalar, Note: "64MB(Default)/96MB/80MB/72MB/32MB",
+				Get: func(rsf *Rsf) string { return rsf.AccessControlInfo.SystemMode }},
+			{Name: "IdealProcessor", Type: typeScalar, Get: func(rsf *Rsf) string { return dec(rsf.AccessControlInfo.IdealProcessor) }},
+			{Name: "AffinityMask", Type: typeScalar, Get: func(rsf *Rsf) string { return dec(rsf.AccessControlInfo.AffinityMask) }},
+			{Name: "Priority", Type: typeScalar, Get: func(rsf *Rsf) string { return dec(rsf.AccessControlInfo.Priority) }},
+			{Name: "MaxCpu", Type: typeScalar, Get: func(rsf *Rsf) string { return hex(rsf.AccessControlInfo.MaxCpu) }},
+			{Name: "HandleTableSize", Type: typeScalar, Get: func(rsf *Rsf) string { return hex(rsf.AccessControlInfo.HandleTableSize) }},
+			boolKey("DisableDebug", func(rsf *Rsf) bool { return rsf.AccessControlInfo.DisableDebug }),
+			boolKey("EnableForceDebug", func(rsf *Rsf) bool { return rsf.AccessControlInfo.EnableForceDebug }),
+			boolKey("CanWriteSharedPage", func(rsf *Rsf) bool { return rsf.AccessControlInfo.CanWriteSharedPage }),
+			boolKey("CanUsePrivilegedPriority", func(rsf *Rsf) bool { return rsf.AccessControlInfo.CanUsePrivilegedPriority }),
+			boolKey("CanUseNonAlphabetAndNumber", func(rsf *Rsf) bool { return rsf.AccessControlInfo.CanUseNonAlphabetAndNumber }),
+			boolKey("PermitMainFunctionArgument", func(rsf *Rsf) bool { return rsf.AccessControlInfo.PermitMainFunctionArgument }),
+			boolKey("CanShareDeviceMemory", func(rsf *Rsf) bool { return rsf.AccessControlInfo.CanShareDeviceMemory }),
+			boolKey("UseOtherVariationSaveData", func(rsf *Rsf) bool { return rsf.AccessControlInfo.UseOtherVariationSaveData }),
+			boolKey("RunnableOnSleep", func(rsf *Rsf) bool { return rsf.AccessControlInfo.RunnableOnSleep }),
+			boolKey("SpecialMemoryArrange", func(rsf *Rsf) bool { return rsf.AccessControlInfo.SpecialMemoryArrange }),
+		},
+		{
+			{Name: "SystemModeExt", Type: typeScalar, Note: "Legacy(Default)/124MB/178MB  Legacy:Use Old3DS SystemMode",
+				Get: func(rsf *Rsf) string { return rsf.AccessControlInfo.SystemModeExt }},
+			{Name: "CpuSpeed", Type: typeScalar, Note: "256MHz(Default)/804MHz",
+				Get: func(rsf *Rsf) string { return rsf.AccessControlInfo.CpuSpeed }},
+			{Name: "EnableL2Cache", Type: typeScalar, Note: "false(default)/true",
+				Get: func(rsf *Rsf) string { return truth(rsf.AccessControlInfo.EnableL2Cache) }},
+			boolKey("CanAccessCore2", func(rsf *Rsf) bool { return rsf.AccessControlInfo.CanAccessCore2 }),
+		},
+		{
+			{Name: "IORegisterMapping", Type: typeList, Items: func(rsf *Rsf) []item { return stringItems(rsf.AccessControlInfo.IORegisterMapping) }},
+			{Name: "MemoryMapping", Type: typeList, Items: func(rsf *Rsf) []item { return stringItems(rsf.AccessControlInfo.MemoryMapping) }},
+		},
+		{
+			{Name: "SystemCallAccess", Type: typeMap, Comments: []string{"Accessible SVCs, <Name>:<ID>"},
+				Items: func(rsf *Rsf) []item {
+					var items []item
+					ids := rsf.AccessControlInfo.SystemCallAccess
+					for i := 0; i < len(ids); i++ {
+						items = append(items, item{Key: rsf.SvcNames.Name(ids[i]), Value: dec(ids[i])})
+					}
+					return items
+				}},
+		},
+		{
+			{Name: "InterruptNumbers", Type: typeList,
+				Items: func(rsf *Rsf) []item {
+					numbers := rsf.AccessControlInfo.InterruptNumbers
+					items := make([]item, len(numbers))
+					for i := 0; i < len(numbers); i++ {
+						items[i].Value = hexFill(numbers[i], 2)
+					}
+					return items
+				},
+				Omit: func(rsf *Rsf) bool { return len(rsf.AccessControlInfo.InterruptNumbers) == 0 }},
+		},
+		{
+			{Name: "OtherKernelCaps", Type: typeList, Comments: []string{"Kernel capability descriptors makerom cannot write, kept as they were"},
+				Items: func(rsf *Rsf) []item {
+					descriptors := rsf.AccessControlInfo.OtherKernelCaps
+					items := make([]item, len(descriptors))
+					for i := 0; i < len(descriptors); i++ {
+						items[i] = item{Value: hexFill(descriptors[i], 8), Disabled: true}
+					}
+					return items
+				},
+				Omit: func(rsf *Rsf) bool { return len(rsf.AccessControlInfo.OtherKernelCaps) == 0 },
+				Disabled: func(rsf *Rsf) bool { return true }},
+		},
+		{
+			{Name: "ServiceAccessControl", Type: typeList, Comments: []string{"Service List", "Maximum 34 services (32 if firmware is prior to 9.6.0)"},
+				Items: func(rsf *Rsf) []item { return stringItems(rsf.AccessControlInfo.ServiceAccessControl) }},
+		},
+	}},
+	{"SystemControlInfo", [][]key {
+		{
+			{Name: "AppType", Type: typeScalar, Get: func(rsf *Rsf) string { return rsf.SystemControlInfo.AppType },
+				Default: func(rsf *Rsf) string { return "application" }},
+			{Name: "StackSize", Type: typeScalar, Get: func(rsf *Rsf) string { return hex(rsf.SystemControlInfo.StackSize) }},
+			{Name: "RemasterVersion", Type: typeScalar, Get: func(rsf *Rsf) string { return hex(rsf.SystemControlInfo.RemasterVersion) }},
+			{Name: "JumpId", Type: typeScalar, Get: func(rsf *Rsf) string { return hexFill(rsf.SystemControlInfo.JumpId, 6) },
+				Default: func(rsf *Rsf) string {
+					programId, _ := rsf.ProgramId()
+					return hexFill(programId, 6)
+				}},
+			{Name: "SaveDataSize", Type: typeScalar, Get: func(rsf *Rsf) string { return size(rsf.SystemControlInfo.SaveDataSize) }},
+		},
+		{
+			{Name: "Dependency", Type: typeMap,
+				Comments: []string{"Modules that run services listed above should be included below", "Maximum 48 dependencies", "<module name>:<module titleid>"},
+				Items: func(rsf *Rsf) []item {
+					ids := rsf.SystemControlInfo.Dependency
+					items := make([]item, len(ids))
+					for i := 0; i < len(ids); i++ {
+						items[i] = item{Key: dependencies[ids[i]], Value: hex(ids[i])}
+						if (items[i].Key == "") { // Unknown module, named by its title ID
+							items[i].Key = items[i].Value
+						}
+					}
+					return items
+				}},
+		},
+	}},
+}
+
+// Write writes rsf in the format read by makerom.
+func Write(w io.Writer, rsf *Rsf) error {
+	out := &emitter{Writer: w}
+	for i := 0; i < len(schema); i++ {
+		if (rsf.Cfa && (schema[i].Name == "AccessControlInfo" || schema[i].Name == "SystemControlInfo")) {
+			continue
+		}
+		if (i > 0) {
+			out.line(0, "")
+		}
+		out.section(rsf, &schema[i])
+	}
+	return out.err
+}
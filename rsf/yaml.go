@@ -0,0 +1,174 @@
+package rsf
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// The YAML written for an RSF is described by schema: sections of keys, each
+// with a type deciding how its value is written. Adding a key to the output
+// only needs a new entry there.
+
+type valueType int
+
+const (
+	typeString valueType = iota // Always double-quoted
+	typeScalar // Numbers, booleans and names, quoted only when needed
+	typeList
+	typeMap
+)
+
+// A list item, or a map entry when Key is set.
+type item struct {
+	Key string
+	Value string
+	Disabled bool // Written commented out
+}
+
+type key struct {
+	Name string
+	Type valueType
+	Comments []string // Lines written above the key
+	Note string // Trailing comment
+	GetNote func(rsf *Rsf) string // Replaces Note when not empty
+	Get func(rsf *Rsf) string // Value of string and scalar keys
+	Items func(rsf *Rsf) []item // Entries of list and map keys
+	Omit func(rsf *Rsf) bool // Leaves the key out
+	Disabled func(rsf *Rsf) bool // Writes the key commented out
+	Default func(rsf *Rsf) string // Value makerom uses when the key is absent, compared ignoring case
+}
+
+type section struct {
+	Name string
+	Groups [][]key // Separated by blank lines, groups with every key omitted are dropped
+}
+
+type emitter struct {
+	io.Writer
+	err error // First write error, later writes are skipped
+}
+
+func (out *emitter) line(indent int, text string) {
+	if (out.err != nil) {
+		return
+	}
+	_, out.err = io.WriteString(out.Writer, strings.Repeat("  ", indent) + text + "\n")
+}
+
+func (out *emitter) section(rsf *Rsf, s *section) {
+	out.line(0, s.Name + ":")
+	written := false
+	for i := 0; i < len(s.Groups); i++ {
+		group := s.Groups[i]
+		started := false
+		for j := 0; j < len(group); j++ {
+			if (group[j].Omit != nil && group[j].Omit(rsf)) {
+				continue
+			}
+			if (written && !started) {
+				out.line(0, "")
+			}
+			started = true
+			out.key(rsf, &group[j])
+		}
+		written = written || started
+	}
+}
+
+func (k *key) note(rsf *Rsf) string {
+	if (k.GetNote != nil && k.GetNote(rsf) != "") {
+		return k.GetNote(rsf)
+	}
+	return k.Note
+}
+
+func (out *emitter) key(rsf *Rsf, k *key) {
+	for i := 0; i < len(k.Comments); i++ {
+		out.line(1, "# " + k.Comments[i])
+	}
+	name := k.Name
+	if (k.Disabled != nil && k.Disabled(rsf)) {
+		name = "#" + name
+	}
+
+	switch k.Type {
+		case typeString, typeScalar:
+			value := k.Get(rsf)
+			if (k.Type == typeString) {
+				value = quotes(value)
+			} else {
+				value = scalar(value)
+			}
+			text := strings.TrimRight(name + " : " + value, " ")
+			if note := k.note(rsf); note != "" {
+				text += " # " + note
+			}
+			out.line(1, text)
+		case typeList, typeMap:
+			out.line(1, name + ":")
+			items := k.Items(rsf)
+			for i := 0; i < len(items); i++ {
+				prefix := ""
+				if (items[i].Disabled) {
+					prefix = "#"
+				}
+				if (k.Type == typeMap) {
+					out.line(0, prefix + "    " + scalar(items[i].Key) + ": " + scalar(items[i].Value))
+				} else {
+					out.line(0, prefix + "     - " + scalar(items[i].Value))
+				}
+			}
+	}
+}
+
+// Returns value as is when it is a valid plain YAML scalar, quoted otherwise.
+// An empty value is left empty.
+func scalar(value string) string {
+	if (value == "") {
+		return value
+	}
+	if (strings.ContainsAny(value[:1], "-?:,[]{}#&*!|>'\"%@` ") || strings.HasSuffix(value, " ") || strings.HasSuffix(value, ":") ||
+		strings.Contains(value, ": ") || strings.Contains(value, " #")) {
+		return quotes(value)
+	}
+	for i := 0; i < len(value); i++ {
+		if (value[i] < 0x20 || value[i] >= 0x7F) {
+			return quotes(value)
+		}
+	}
+	return value
+}
+
+// Returns in as a YAML double-quoted string. Only escapes also understood by
+// strconv.Unquote are used; bytes that are not UTF-8 become \x escapes.
+func quotes(in string) string {
+	out := &strings.Builder{}
+	out.WriteByte('"')
+	for i := 0; i < len(in); {
+		r, n := utf8.DecodeRuneInString(in[i:])
+		switch {
+			case r == utf8.RuneError && n == 1:
+				fmt.Fprintf(out, "\\x%02x", in[i])
+			case r == '"' || r == '\\':
+				out.WriteByte('\\')
+				out.WriteRune(r)
+			case r == '\n':
+				out.WriteString("\\n")
+			case r == '\t':
+				out.WriteString("\\t")
+			case r == '\r':
+				out.WriteString("\\r")
+			case r < 0x20 || r == 0x7F:
+				fmt.Fprintf(out, "\\x%02x", r)
+			case r == 0x85 || r == 0x2028 || r == 0x2029 || r == 0xFEFF: // Line breaks and BOM YAML would not keep
+				fmt.Fprintf(out, "\\u%04x", r)
+			default:
+				out.WriteString(in[i:i + n])
+		}
+		i += n
+	}
+	out.WriteByte('"')
+	return out.String()
+}